@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/onrik/logrus/filename"
+	log "github.com/sirupsen/logrus"
+	"github.com/turbobytes/kubemr/pkg/job"
+	"github.com/turbobytes/kubemr/pkg/k8s"
+	"github.com/turbobytes/kubemr/pkg/tracing"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes"
+)
+
+//Exit codes
+const (
+	exitOK       = 0 //Job completed, results written
+	exitFailed   = 1 //Job ran and failed
+	exitInvalid  = 2 //Bad flags, job spec or config, nothing was started
+	exitTimeout  = 3 //Job did not finish within -timeout
+	exitNotRun   = 4 //Job could not be started, e.g. Kubernetes errors or another run with concurrencypolicy Forbid
+	exitNoReport = 5 //Job completed, but the results could not be written
+)
+
+var (
+	spec             = flag.String("job", os.Getenv("KUBEMR_JOB"), "Path to the job spec, YAML or JSON. - reads stdin")
+	configmap        = flag.String("configmap", os.Getenv("KUBEMR_JOB_CONFIGMAP"), "[namespace/]name of a ConfigMap holding the job spec, instead of -job")
+	kubeconfig       = flag.String("kubeconfig", "", "Path to kubeconfig, if absent then we use rest.InClusterConfig()")
+	apiserver        = flag.String("apiserver", "", "Url to apiserver, blank to read from kubeconfig")
+	workerkubeconfig = flag.String("workerkubeconfig", "", "Path to kubeconfig of the cluster running the workers, if absent then workers run alongside the master")
+	s3region         = flag.String("s3region", os.Getenv("KUBEMR_S3_REGION"), "The S3 region of the bucket")
+	s3endpoint       = flag.String("s3endpoint", os.Getenv("KUBEMR_S3_ENDPOINT"), "The S3 endpoint (overrides region)")
+	bucketname       = flag.String("bucketname", os.Getenv("KUBEMR_S3_BUCKET_NAME"), "A pre-existing bucket")
+	bucketprefix     = flag.String("bucketprefix", os.Getenv("KUBEMR_S3_BUCKET_PREFIX"), "Prepended to all keys, to reduce clutter in bucket root")
+	addr             = flag.String("addr", ":8989", "Address the master listens on for workers")
+	timeout          = flag.Duration("timeout", time.Hour, "Fail the job if it does not finish in time")
+	results          = flag.String("results", "-", "File to write the results to as JSON, - for stdout")
+	resultsconfigmap = flag.String("resultsconfigmap", "", "[namespace/]name of a ConfigMap to write the results to, under results.json")
+)
+
+func init() {
+	filenameHook := filename.NewHook()
+	log.AddHook(filenameHook)
+	flag.Parse()
+}
+
+//Report is what we write out once the job is over
+type Report struct {
+	Name     string           `json:"name"`
+	RunID    string           `json:"runid"`
+	Status   string           `json:"status"`
+	Err      string           `json:"error,omitempty"`
+	Results  []job.ResultPart `json:"results"`
+	Counters job.Counters     `json:"counters"`
+	Summary  *job.Summary     `json:"summary,omitempty"`
+}
+
+//splitName splits [namespace/]name, namespace defaults to ns
+func splitName(s, ns string) (string, string) {
+	if parts := strings.SplitN(s, "/", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return ns, s
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	if (*spec == "") == (*configmap == "") {
+		log.Error("Exactly one of -job or -configmap must be given")
+		return exitInvalid
+	}
+	config, err := k8s.GetConfig(*apiserver, *kubeconfig)
+	if err != nil {
+		log.Error(err)
+		return exitNotRun
+	}
+	cl, err := k8s.GetKubernetes(config)
+	if err != nil {
+		log.Error(err)
+		return exitNotRun
+	}
+	namespace := os.Getenv("MY_POD_NAMESPACE")
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	var jb *job.MapReduceJob
+	if *configmap != "" {
+		ns, name := splitName(*configmap, namespace)
+		jb, err = job.ReadSpecConfigMap(cl, ns, name, "")
+	} else {
+		jb, err = job.ReadSpecFile(*spec)
+	}
+	if err != nil {
+		log.Error(err)
+		return exitInvalid
+	}
+	cfg := job.NewConfigEnv()
+	cfg.S3Region = *s3region
+	cfg.S3Endpoint = *s3endpoint
+	cfg.BucketName = *bucketname
+	cfg.BucketPrefix = *bucketprefix
+	//Flags and env override the spec
+	for dst, value := range map[*string]string{
+		&jb.Namespace:        os.Getenv("MY_POD_NAMESPACE"),
+		&jb.MasterPod:        os.Getenv("MY_POD_NAME"),
+		&jb.WorkerNamespace:  os.Getenv("KUBEMR_WORKER_NAMESPACE"),
+		&jb.WorkerKubeconfig: *workerkubeconfig,
+		&jb.AdvertiseURL:     os.Getenv("KUBEMR_ADVERTISE_URL"),
+		&jb.ServiceType:      os.Getenv("KUBEMR_SERVICE_TYPE"),
+	} {
+		if value != "" {
+			*dst = value
+		}
+	}
+	if os.Getenv("KUBEMR_NETWORK_POLICY") == "true" {
+		jb.NetworkPolicy = true
+	}
+	//Check everything before touching the cluster
+	errs := jb.Validate()
+	errs = append(errs, cfg.ValidateFields(field.NewPath("config"))...)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Error(err)
+		}
+		return exitInvalid
+	}
+	shutdown, err := tracing.Init("kubemr-master", cfg.OTLPEndpoint)
+	if err != nil {
+		log.Error(err)
+		return exitNotRun
+	}
+	defer shutdown()
+	err = jb.Init(cl, *addr, os.Getenv("MY_POD_IP"), cfg)
+	if err != nil {
+		log.Error(err)
+		return exitNotRun
+	}
+	//Fail the job on SIGINT and SIGTERM so its workers are deleted, they outlive us when nothing owns them
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		jb.Abort("Received " + (<-sigs).String())
+	}()
+	joberr := jb.Start(*timeout)
+	code := exitOK
+	switch {
+	case joberr == job.ErrTimeout:
+		log.Error(joberr)
+		code = exitTimeout
+	case joberr != nil:
+		log.Error(joberr)
+		code = exitFailed
+	}
+	err = writeReport(cl, namespace, Report{
+		Name:     jb.Name,
+		RunID:    jb.RunID,
+		Status:   jb.Status,
+		Err:      jb.Err,
+		Results:  jb.Results,
+		Counters: jb.Counters,
+		Summary:  jb.Summary,
+	})
+	if err != nil {
+		log.Error(err)
+		if code == exitOK {
+			code = exitNoReport
+		}
+	}
+	return code
+}
+
+//writeReport writes the report as JSON to -results and -resultsconfigmap
+func writeReport(cl kubernetes.Interface, namespace string, report Report) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	switch *results {
+	case "":
+	case "-":
+		_, err = os.Stdout.Write(b)
+	default:
+		err = ioutil.WriteFile(*results, b, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	if *resultsconfigmap == "" {
+		return nil
+	}
+	ns, name := splitName(*resultsconfigmap, namespace)
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+			Labels:    map[string]string{"kubemr-job": report.Name, "kubemr-run": report.RunID},
+		},
+		Data: map[string]string{"results.json": string(b)},
+	}
+	_, err = cl.CoreV1().ConfigMaps(ns).Update(cm)
+	if errors.IsNotFound(err) {
+		_, err = cl.CoreV1().ConfigMaps(ns).Create(cm)
+	}
+	return err
+}
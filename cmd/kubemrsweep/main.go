@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/onrik/logrus/filename"
+	log "github.com/sirupsen/logrus"
+	"github.com/turbobytes/kubemr/pkg/storage"
+	"gopkg.in/amz.v1/aws"
+)
+
+var (
+	s3region     = flag.String("s3region", os.Getenv("KUBEMR_S3_REGION"), "The S3 region of the bucket")
+	s3endpoint   = flag.String("s3endpoint", os.Getenv("KUBEMR_S3_ENDPOINT"), "The S3 endpoint (overrides region)")
+	bucketname   = flag.String("bucketname", os.Getenv("KUBEMR_S3_BUCKET_NAME"), "The bucket used by jobs")
+	bucketprefix = flag.String("bucketprefix", os.Getenv("KUBEMR_S3_BUCKET_PREFIX"), "The bucket prefix used by jobs, each run of a job has its own prefix under it. Required, the bucket root is not swept")
+	ttl          = flag.Duration("ttl", 7*24*time.Hour, "Delete run prefixes not written to for this long")
+	dryrun       = flag.Bool("dryrun", false, "Only list the run prefixes that would be deleted")
+)
+
+func init() {
+	filenameHook := filename.NewHook()
+	log.AddHook(filenameHook)
+	flag.Parse()
+}
+
+func main() {
+	auth := aws.Auth{
+		AccessKey: os.Getenv("KUBEMR_S3_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("KUBEMR_S3_SECRET_ACCESS_KEY"),
+	}
+	st, err := storage.NewS3(auth, *s3region, *s3endpoint, *bucketname)
+	if err != nil {
+		log.Fatal(err)
+	}
+	swept, err := storage.Sweep(st, *bucketprefix, *ttl, time.Now(), *dryrun)
+	for _, prefix := range swept {
+		if *dryrun {
+			log.Infof("Would delete %s", prefix)
+		} else {
+			log.Infof("Deleted %s", prefix)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strconv"
+
+	"github.com/onrik/logrus/filename"
+	log "github.com/sirupsen/logrus"
+	"github.com/turbobytes/kubemr/pkg/tracing"
+	"github.com/turbobytes/kubemr/pkg/worker"
+)
+
+var (
+	mode       = flag.String("mode", envDefault("KUBEMR_WORKER_MODE", "exec"), "exec or streaming")
+	mapcmd     = flag.String("map", os.Getenv("KUBEMR_MAP_CMD"), "Shell command run for each map task")
+	reducecmd  = flag.String("reduce", os.Getenv("KUBEMR_REDUCE_CMD"), "Shell command run for each reduce task")
+	partitions = flag.Int("partitions", envInt("KUBEMR_PARTITIONS", 1), "Number of reduce partitions in streaming mode")
+)
+
+func envDefault(key, def string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+func envInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func init() {
+	filenameHook := filename.NewHook()
+	log.AddHook(filenameHook)
+	flag.Parse()
+}
+
+func shell(cmd string) []string {
+	if cmd == "" {
+		return nil
+	}
+	return []string{"sh", "-c", cmd}
+}
+
+func main() {
+	shutdown, err := tracing.InitEnv("kubemr-worker")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer shutdown()
+	runner, err := worker.NewRunner()
+	if err != nil {
+		log.Error(err)
+		return //Silent fail
+	}
+	var w worker.JobWorker
+	switch *mode {
+	case "exec":
+		w = &worker.ExecWorker{
+			MapCmd:    shell(*mapcmd),
+			ReduceCmd: shell(*reducecmd),
+		}
+	case "streaming":
+		w = &worker.StreamingWorker{
+			Mapper:     shell(*mapcmd),
+			Reducer:    shell(*reducecmd),
+			Partitions: *partitions,
+		}
+	default:
+		log.Errorf("Unknown mode %s", *mode)
+		return
+	}
+	err = runner.Run(w)
+	if err != nil {
+		log.Error(err)
+	}
+	//Terminate successfully to let k8s clear this pod
+}
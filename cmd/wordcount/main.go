@@ -14,6 +14,7 @@ import (
 
 	"github.com/onrik/logrus/filename"
 	log "github.com/sirupsen/logrus"
+	"github.com/turbobytes/kubemr/pkg/tracing"
 	"github.com/turbobytes/kubemr/pkg/worker"
 )
 
@@ -161,6 +162,12 @@ func init() {
 }
 
 func main() {
+	shutdown, err := tracing.InitEnv("kubemr-worker")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer shutdown()
 	runner, err := worker.NewRunner()
 	if err != nil {
 		log.Error(err)
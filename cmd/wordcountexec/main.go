@@ -1,17 +1,20 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/turbobytes/kubemr/pkg/job"
 	"github.com/turbobytes/kubemr/pkg/k8s"
+	"github.com/turbobytes/kubemr/pkg/tracing"
 )
 
 var (
@@ -21,6 +24,10 @@ var (
 	bucketprefix = flag.String("bucketprefix", "", "Prepended to all keys, to reduce clutter in bucket root")
 	apiserver    = flag.String("apiserver", "", "Url to apiserver, blank to read from kubeconfig")
 	s3endpoint   = flag.String("s3endpoint", "", "The S3 endpoint we wanna use for temporary stuff(overrides region)")
+	workerconfig = flag.String("workerkubeconfig", "", "path to kubeconfig of the cluster running the workers, if absent then workers run alongside the master")
+	spec         = flag.String("job", "/wordcount.yaml", "path to the job spec, YAML or JSON. - reads stdin")
+	configmap    = flag.String("configmap", "", "[namespace/]name of a ConfigMap holding the job spec, instead of -job")
+	schema       = flag.Bool("schema", false, "print the JSON Schema of job specs and exit")
 )
 
 func init() {
@@ -28,51 +35,13 @@ func init() {
 }
 
 func main() {
-	j := `
-  {
-    "name": "wordcount",
-    "inputs": ["https://tools.ietf.org/rfc/rfc4501.txt", "https://tools.ietf.org/rfc/rfc2017.txt", "https://tools.ietf.org/rfc/rfc2425.txt"],
-    "replicas": 5,
-    "template": {
-      "spec": {
-        "volumes":[{
-          "name":"tmpdir",
-          "emptyDir": {}
-        }],
-        "containers": [{
-          "name": "kubemrworker",
-          "image": "turbobytes/kubemr-wordcount",
-          "imagePullPolicy": "Always",
-          "volumeMounts": [{
-            "name": "tmpdir",
-            "mountPath": "/tmp"
-          }],
-          "env":[{
-            "name": "KUBEMR_S3_ACCESS_KEY_ID",
-            "valueFrom": {
-              "secretKeyRef": {
-                "name": "aws",
-                "key": "aws_access_key_id"
-              }
-            }
-          },{
-            "name": "KUBEMR_S3_SECRET_ACCESS_KEY",
-            "valueFrom": {
-              "secretKeyRef": {
-                "name": "aws",
-                "key": "aws_secret_access_key"
-              }
-            }
-          }]
-        }]
-      }
-    }
-  }
-  `
-	jb := &job.MapReduceJob{}
-	err := json.Unmarshal([]byte(j), jb)
-	if err != nil {
-		panic(err)
+	if *schema {
+		b, err := job.Schema()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(b))
+		return
 	}
 	config, err := k8s.GetConfig(*apiserver, *kubeconfig)
 	if err != nil {
@@ -82,14 +51,66 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	var jb *job.MapReduceJob
+	if *configmap != "" {
+		namespace, name := "default", *configmap
+		if parts := strings.SplitN(*configmap, "/", 2); len(parts) == 2 {
+			namespace, name = parts[0], parts[1]
+		}
+		jb, err = job.ReadSpecConfigMap(cl, namespace, name, "")
+	} else {
+		jb, err = job.ReadSpecFile(*spec)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 	cfg := job.NewConfigEnv()
+	//Flags override env
+	for dst, value := range map[*string]string{
+		&cfg.S3Region:     *s3region,
+		&cfg.S3Endpoint:   *s3endpoint,
+		&cfg.BucketName:   *bucketname,
+		&cfg.BucketPrefix: *bucketprefix,
+	} {
+		if value != "" {
+			*dst = value
+		}
+	}
+	//Flags and env override the spec
+	for dst, value := range map[*string]string{
+		&jb.MasterPod:        os.Getenv("MY_POD_NAME"),
+		&jb.WorkerNamespace:  os.Getenv("KUBEMR_WORKER_NAMESPACE"),
+		&jb.WorkerKubeconfig: *workerconfig,
+		&jb.AdvertiseURL:     os.Getenv("KUBEMR_ADVERTISE_URL"),
+		&jb.ServiceType:      os.Getenv("KUBEMR_SERVICE_TYPE"),
+	} {
+		if value != "" {
+			*dst = value
+		}
+	}
+	if os.Getenv("KUBEMR_NETWORK_POLICY") == "true" {
+		jb.NetworkPolicy = true
+	}
+	shutdown, err := tracing.Init("kubemr-master", cfg.OTLPEndpoint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdown()
 	err = jb.Init(cl, ":8989", os.Getenv("MY_POD_IP"), cfg)
 	if err != nil {
 		panic(err)
 	}
+	//Interrupting us fails the job, which deletes the workers instead of leaving them behind
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		jb.Abort("Received " + (<-sigs).String())
+	}()
 	err = jb.Start(time.Minute)
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println(jb.Results)
+	for _, result := range jb.Results {
+		fmt.Println(result.URI)
+	}
 }
@@ -0,0 +1,39 @@
+package job
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/turbobytes/kubemr/pkg/storage"
+)
+
+const (
+	//CleanupOnSuccess deletes intermediate outputs once the job completes, keeping them to debug failures
+	CleanupOnSuccess = "OnSuccess"
+	//CleanupAlways deletes intermediate outputs however the job ends
+	CleanupAlways = "Always"
+	//CleanupNever keeps intermediate outputs
+	CleanupNever = "Never"
+)
+
+//cleanupStorage deletes what task attempts wrote according to CleanupPolicy, published results are always kept
+func (jb *MapReduceJob) cleanupStorage(joberr error) error {
+	switch jb.CleanupPolicy {
+	case CleanupNever:
+		return nil
+	case CleanupOnSuccess:
+		if joberr != nil {
+			log.Info("Keeping intermediate outputs of failed job")
+			return nil
+		}
+	}
+	st, err := jb.config.GetStorage()
+	if err != nil {
+		return err
+	}
+	prefix := jb.config.BucketPrefix + TemporaryDir
+	n, err := storage.DeletePrefix(st, prefix)
+	if err != nil {
+		return err
+	}
+	log.Infof("Deleted %v intermediate outputs under %s", n, prefix)
+	return nil
+}
@@ -2,6 +2,7 @@ package job
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -9,12 +10,15 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 //Client uses a jobs http API
 type Client struct {
 	baseurl string
 	client  *http.Client
+	jobctx  context.Context //Carries the trace of the job, as sent by the master
 }
 
 //NewClient creates new job client
@@ -22,6 +26,7 @@ func NewClient(baseurl string) *Client {
 	return &Client{
 		baseurl: baseurl,
 		client:  &http.Client{Timeout: 20 * time.Second},
+		jobctx:  context.Background(),
 	}
 }
 
@@ -35,17 +40,24 @@ func (cl *Client) GetJob() (*MapReduceJob, error) {
 		return nil, fmt.Errorf("Got status: %s", resp.Status)
 	}
 	defer resp.Body.Close()
+	cl.jobctx = otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(resp.Header))
 	decoder := json.NewDecoder(resp.Body)
 	jb := &MapReduceJob{}
 	err = decoder.Decode(jb)
 	return jb, err
 }
 
-func (cl *Client) put(url string, payload []byte) (bool, error) {
+//JobContext returns a context carrying the trace of the job, use it as parent for worker spans
+func (cl *Client) JobContext() context.Context {
+	return cl.jobctx
+}
+
+func (cl *Client) put(ctx context.Context, url string, payload []byte) (bool, error) {
 	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(payload))
 	if err != nil {
 		return false, err
 	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 	resp, err := cl.client.Do(req)
 	if err != nil {
 		return false, err
@@ -72,20 +84,30 @@ func (cl *Client) put(url string, payload []byte) (bool, error) {
 
 //PutMap puts MapTask
 func (cl *Client) PutMap(task MapTask, taskid int) (bool, error) {
+	return cl.PutMapContext(context.Background(), task, taskid)
+}
+
+//PutMapContext puts MapTask, propagating the trace in ctx to the master
+func (cl *Client) PutMapContext(ctx context.Context, task MapTask, taskid int) (bool, error) {
 	payload, err := json.Marshal(task)
 	if err != nil {
 		return false, err
 	}
 	url := fmt.Sprintf("%smap/%v/", cl.baseurl, taskid)
-	return cl.put(url, payload)
+	return cl.put(ctx, url, payload)
 }
 
 //PutReduce puts ReduceTask
 func (cl *Client) PutReduce(task ReduceTask, taskid int) (bool, error) {
+	return cl.PutReduceContext(context.Background(), task, taskid)
+}
+
+//PutReduceContext puts ReduceTask, propagating the trace in ctx to the master
+func (cl *Client) PutReduceContext(ctx context.Context, task ReduceTask, taskid int) (bool, error) {
 	payload, err := json.Marshal(task)
 	if err != nil {
 		return false, err
 	}
 	url := fmt.Sprintf("%sreduce/%v/", cl.baseurl, taskid)
-	return cl.put(url, payload)
+	return cl.put(ctx, url, payload)
 }
@@ -0,0 +1,194 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/turbobytes/kubemr/pkg/storage"
+)
+
+//TemporaryDir holds what task attempts write, under the run prefix
+const TemporaryDir = "_temporary/"
+
+//AttemptPrefix returns where an attempt of a task writes its outputs, relative to the run prefix
+func AttemptPrefix(phase string, taskid int, worker string) string {
+	return fmt.Sprintf("%s%s-%v-%s/", TemporaryDir, phase, taskid, worker)
+}
+
+//CounterOutputRecords is the counter workers report the records written by a reduce task with
+const CounterOutputRecords = "kubemr.output.records"
+
+//ResultPart is the result of a reduce partition
+type ResultPart struct {
+	Partition int    `json:"partition"`
+	URI       string `json:"uri"`
+	Size      int64  `json:"size"`               //Bytes, only known if published by the master
+	Records   int64  `json:"records"`            //As reported by the worker with CounterOutputRecords
+	Checksum  string `json:"checksum,omitempty"` //sha256:<hex> or md5:<hex>, only known if published by the master
+}
+
+//Manifest is written as _SUCCESS next to the results of a completed job
+type Manifest struct {
+	Name     string       `json:"name"`
+	RunID    string       `json:"runid"`
+	Finished time.Time    `json:"finished"`
+	Results  []ResultPart `json:"results"` //Ordered by partition
+}
+
+//uri returns the URI of key in the bucket
+func (jb *MapReduceJob) uri(key string) string {
+	return "s3://" + jb.config.BucketName + key
+}
+
+//temporaryKey returns the key of uri if it was written by a task attempt of this run
+func (jb *MapReduceJob) temporaryKey(uri string) (string, bool) {
+	prefix := jb.uri(jb.config.BucketPrefix + TemporaryDir)
+	if !strings.HasPrefix(uri, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(uri, "s3://"+jb.config.BucketName), true
+}
+
+//publish commits reduces, a copy of the completed reduce tasks, without holding the job lock. Then completes the job
+//jb.published is closed once it is done
+func (jb *MapReduceJob) publish(reduces map[int]ReduceTask) {
+	defer close(jb.published)
+	results, err := jb.commit(reduces)
+	jb.Lock()
+	//The job failed meanwhile, e.g. timed out. Its results must not look complete
+	if jb.Status != StatusReduce {
+		jb.Unlock()
+		if err == nil {
+			jb.retract(results)
+		}
+		return
+	}
+	if err != nil {
+		jb.Err = fmt.Sprintf("Unable to publish results: %s", err)
+		jb.setStatus(StatusFail)
+	} else {
+		jb.Results = results
+		jb.setStatus(StatusComplete)
+	}
+	jb.poke <- true
+	jb.Unlock()
+}
+
+//retract deletes the results commit published to Output, along with the _SUCCESS manifest
+func (jb *MapReduceJob) retract(results []ResultPart) {
+	prefix := jb.uri(jb.Output)
+	keys := make([]string, 0, len(results)+1)
+	for _, part := range results {
+		if strings.HasPrefix(part.URI, prefix) {
+			keys = append(keys, jb.Output+strings.TrimPrefix(part.URI, prefix))
+		}
+	}
+	//Storage is not touched if nothing was published
+	if len(keys) == 0 {
+		return
+	}
+	st, err := jb.config.GetStorage()
+	if err != nil {
+		log.Errorf("Unable to retract results: %s", err)
+		return
+	}
+	log.Infof("Job is over, retracting %v results from %s", len(keys), jb.Output)
+	unpublish(st, append(keys, jb.Output+"_SUCCESS"))
+}
+
+//checkOutput makes sure the master can reach storage, and that Output holds nothing yet
+//Called by Init, so jobs fail before doing any work rather than once it is all done
+func (jb *MapReduceJob) checkOutput() error {
+	st, err := jb.config.GetStorage()
+	if err != nil {
+		return err
+	}
+	return jb.checkEmpty(st)
+}
+
+//checkEmpty refuses to publish to an Output holding results of another run
+func (jb *MapReduceJob) checkEmpty(st storage.Storage) error {
+	objects, err := st.List(jb.Output)
+	if err != nil {
+		return fmt.Errorf("Unable to reach storage, the master needs KUBEMR_S3_ACCESS_KEY_ID and KUBEMR_S3_SECRET_ACCESS_KEY: %s", err)
+	}
+	if len(objects) > 0 {
+		return fmt.Errorf("Output %s is not empty", jb.uri(jb.Output))
+	}
+	return nil
+}
+
+//commit publishes the outputs of the completed reduce tasks to Output, followed by the _SUCCESS manifest
+//Only the attempt that completed a task is published. Outputs not written by attempts, e.g. database tables, are passed along as is,
+//and storage is not touched if there are only those. If publishing fails half way, what was published is deleted
+//Returns the results ordered by partition
+func (jb *MapReduceJob) commit(reduces map[int]ReduceTask) ([]ResultPart, error) {
+	ids := make([]int, 0, len(reduces))
+	for id := range reduces {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	var st storage.Storage
+	published := make([]string, 0)
+	results := make([]ResultPart, 0)
+	for _, id := range ids {
+		task := reduces[id]
+		if task.Output == "" {
+			continue
+		}
+		part := ResultPart{Partition: id, URI: task.Output, Records: task.Counters[CounterOutputRecords]}
+		src, ok := jb.temporaryKey(task.Output)
+		if ok {
+			if st == nil {
+				var err error
+				st, err = jb.config.GetStorage()
+				if err != nil {
+					return nil, err
+				}
+				err = jb.checkEmpty(st)
+				if err != nil {
+					return nil, err
+				}
+			}
+			object, err := st.Copy(src, fmt.Sprintf("%spart-%05d%s", jb.Output, id, path.Ext(src)))
+			if err != nil {
+				unpublish(st, published)
+				return nil, err
+			}
+			published = append(published, object.Key)
+			part.URI, part.Size, part.Checksum = jb.uri(object.Key), object.Size, object.Checksum
+		}
+		results = append(results, part)
+	}
+	if st == nil {
+		log.Infof("Nothing to publish, passing on %v results", len(results))
+		return results, nil
+	}
+	manifest, err := json.Marshal(Manifest{Name: jb.Name, RunID: jb.RunID, Finished: time.Now(), Results: results})
+	if err != nil {
+		unpublish(st, published)
+		return nil, err
+	}
+	err = st.Put(jb.Output+"_SUCCESS", manifest)
+	if err != nil {
+		unpublish(st, published)
+		return nil, err
+	}
+	log.Infof("Published %v results to %s", len(results), jb.Output)
+	return results, nil
+}
+
+//unpublish deletes the results published by a failed commit, so they are not mistaken for complete ones
+func unpublish(st storage.Storage, keys []string) {
+	for _, key := range keys {
+		err := st.Delete(key)
+		if err != nil {
+			log.Errorf("Unable to delete partial result %s: %s", key, err)
+		}
+	}
+}
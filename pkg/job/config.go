@@ -1,10 +1,11 @@
 package job
 
 import (
-	"fmt"
 	"os"
 
+	"github.com/turbobytes/kubemr/pkg/storage"
 	"gopkg.in/amz.v1/aws"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 //Config holds values required for workers for kubemr internal things
@@ -16,6 +17,9 @@ type Config struct {
 	BucketName   string //A pre-existing bucket
 	BucketPrefix string //Prepended to all keys, to reduce clutter in bucket root
 	JobURL       string //The URL for job
+	OTLPEndpoint string //Optional: OTLP/HTTP collector for traces
+	//Optional: Used by the master to clean up, instead of the S3 bucket above
+	Storage storage.Storage
 }
 
 //NewConfigEnv populates Config struct from env
@@ -26,19 +30,26 @@ func NewConfigEnv() *Config {
 		BucketName:   os.Getenv("KUBEMR_S3_BUCKET_NAME"),
 		BucketPrefix: os.Getenv("KUBEMR_S3_BUCKET_PREFIX"),
 		JobURL:       os.Getenv("KUBEMR_JOB_URL"),
+		OTLPEndpoint: os.Getenv("KUBEMR_OTLP_ENDPOINT"),
 	}
 }
 
 //Validate validates the config
 func (config *Config) Validate() error {
+	return config.ValidateFields(nil).ToAggregate()
+}
+
+//ValidateFields validates the config, reporting every problem. fld is where it lives in the caller
+func (config *Config) ValidateFields(fld *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
 	_, ok := aws.Regions[config.S3Region]
 	if !ok {
-		return fmt.Errorf("Region %s is invalid", config.S3Region)
+		errs = append(errs, field.Invalid(fld.Child("S3Region"), config.S3Region, "unknown region"))
 	}
 	if config.BucketName == "" {
-		return fmt.Errorf("BucketName must be provided")
+		errs = append(errs, field.Required(fld.Child("BucketName"), "a pre-existing bucket must be provided"))
 	}
-	return nil
+	return errs
 }
 
 //Map converts config to data item for configmap
@@ -48,5 +59,27 @@ func (config *Config) Map() map[string]string {
 		"bucketname":   config.BucketName,
 		"bucketprefix": config.BucketPrefix,
 		"s3endpoint":   config.S3Endpoint,
+		"otlpendpoint": config.OTLPEndpoint,
+	}
+}
+
+//GetStorage returns Storage if set, or the S3 bucket using credentials from env
+func (config *Config) GetStorage() (storage.Storage, error) {
+	return config.OpenBucket(config.BucketName)
+}
+
+//OpenBucket returns the storage for bucket, in the same region and with the same credentials as ours. Used to expand input globs
+func (config *Config) OpenBucket(bucket string) (storage.Storage, error) {
+	if config.Storage != nil && bucket == config.BucketName {
+		return config.Storage, nil
+	}
+	auth := aws.Auth{
+		AccessKey: os.Getenv("KUBEMR_S3_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("KUBEMR_S3_SECRET_ACCESS_KEY"),
+	}
+	st, err := storage.NewS3(auth, config.S3Region, config.S3Endpoint, bucket)
+	if err != nil {
+		return nil, err
 	}
+	return st, nil
 }
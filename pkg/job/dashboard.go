@@ -0,0 +1,159 @@
+package job
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/amz.v1/aws"
+)
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>{{.Name}} - kubemr</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+.bar { width: 30em; height: 1em; background: #eee; }
+.done { height: 100%; background: #4a4; }
+.FAIL { color: #c00; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>Status: <b class="{{.Status}}">{{.Status}}</b></p>
+{{if .Err}}<p class="FAIL">{{.Err}}</p>{{end}}
+{{with .Estimate}}<p>Expecting {{.Phase}} to finish at {{.ETA.Format "15:04:05 MST"}}</p>{{end}}
+{{range .Phases}}
+<h2>{{.Name}}: {{.Done}}/{{.Total}}</h2>
+<div class="bar"><div class="done" style="width: {{.Percent}}%"></div></div>
+<table>
+<tr><th>Task</th><th>Status</th><th>Progress</th><th>Worker</th><th>Duration</th><th>Error</th></tr>
+{{range .Tasks}}<tr><td>{{.ID}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{.Progress}}</td><td>{{.Worker}}</td><td>{{if .Duration}}{{.Duration}}{{end}}</td><td class="FAIL">{{.Err}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Results}}
+<h2>Results</h2>
+<ul>
+{{range .Results}}<li>{{if .URL}}<a href="{{.URL}}">{{.URI}}</a>{{else}}{{.URI}}{{end}}</li>
+{{end}}</ul>
+{{end}}
+</body>
+</html>
+`))
+
+type dashboardTask struct {
+	ID       int
+	Status   string
+	Progress string
+	Worker   string
+	Duration time.Duration
+	Err      string
+}
+
+type dashboardPhase struct {
+	Name    string
+	Done    int
+	Total   int
+	Percent int
+	Tasks   []dashboardTask
+}
+
+type dashboardResult struct {
+	URI string
+	URL string
+}
+
+type dashboard struct {
+	Name     string
+	Status   string
+	Err      string
+	Estimate *Estimate
+	Phases   []dashboardPhase
+	Results  []dashboardResult
+}
+
+func newDashboardPhase(name string, tasks []dashboardTask) dashboardPhase {
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	phase := dashboardPhase{Name: name, Total: len(tasks), Tasks: tasks}
+	for _, task := range tasks {
+		if task.Status == StatusComplete {
+			phase.Done++
+		}
+	}
+	if phase.Total > 0 {
+		phase.Percent = phase.Done * 100 / phase.Total
+	}
+	return phase
+}
+
+func formatProgress(status string, progress *Progress) string {
+	if status != StatusProgress || progress == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprintf("%.0f%% %s", progress.Fraction*100, progress.Message))
+}
+
+//s3Endpoint returns the endpoint of our S3 region, empty if we do not know it
+func (jb *MapReduceJob) s3Endpoint() string {
+	if jb.config.S3Endpoint != "" {
+		return jb.config.S3Endpoint
+	}
+	return aws.Regions[jb.config.S3Region].S3Endpoint
+}
+
+//objectURL turns result URIs into links at endpoint, empty if we do not know how
+func objectURL(endpoint, uri string) string {
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+		return uri
+	}
+	if !strings.HasPrefix(uri, "s3://") || endpoint == "" {
+		return ""
+	}
+	return strings.TrimSuffix(endpoint, "/") + "/" + strings.TrimPrefix(uri, "s3://")
+}
+
+func (jb *MapReduceJob) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	jb.RLock()
+	d := dashboard{Name: jb.Name, Status: jb.Status, Err: jb.Err, Estimate: jb.Estimate}
+	maps := make([]dashboardTask, 0, len(jb.Maps))
+	for id, task := range jb.Maps {
+		maps = append(maps, dashboardTask{
+			ID:       id,
+			Status:   taskStatus(task.Status),
+			Progress: formatProgress(task.Status, task.Progress),
+			Worker:   task.Worker,
+			Duration: task.duration().Truncate(time.Second),
+			Err:      task.Err,
+		})
+	}
+	reduces := make([]dashboardTask, 0, len(jb.Reduces))
+	for id, task := range jb.Reduces {
+		reduces = append(reduces, dashboardTask{
+			ID:       id,
+			Status:   taskStatus(task.Status),
+			Progress: formatProgress(task.Status, task.Progress),
+			Worker:   task.Worker,
+			Duration: task.duration().Truncate(time.Second),
+			Err:      task.Err,
+		})
+	}
+	d.Phases = []dashboardPhase{newDashboardPhase("Map", maps), newDashboardPhase("Reduce", reduces)}
+	endpoint := jb.s3Endpoint()
+	for _, result := range jb.Results {
+		d.Results = append(d.Results, dashboardResult{URI: result.URI, URL: objectURL(endpoint, result.URI)})
+	}
+	jb.RUnlock()
+	w.Header().Set("Content-type", "text/html; charset=utf-8")
+	err := dashboardTemplate.Execute(w, d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
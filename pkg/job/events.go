@@ -0,0 +1,181 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	//EventStatus when the job moves to another status
+	EventStatus = "StatusChanged"
+	//EventTaskAcquired when a worker locks a task
+	EventTaskAcquired = "TaskAcquired"
+	//EventTaskCompleted when a worker finishes a task
+	EventTaskCompleted = "TaskCompleted"
+	//EventTaskFailed when a worker reports a task failure
+	EventTaskFailed = "TaskFailed"
+	//EventPodCreated when a worker pod is created
+	EventPodCreated = "PodCreated"
+	//EventPodDeleted when a worker pod is deleted
+	EventPodDeleted = "PodDeleted"
+	//EventPodLost when a worker pod fails or goes away while the job runs
+	EventPodLost = "PodLost"
+	//EventPodRetired when an idle worker is told to exit
+	EventPodRetired = "PodRetired"
+	//EventTaskReleased when a task is taken away from a lost worker
+	EventTaskReleased = "TaskReleased"
+	//EventInputs when inputs are found by an input source
+	EventInputs = "InputsDiscovered"
+)
+
+//Event records a state transition of the job
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Phase   string    `json:"phase,omitempty"`
+	Task    *int      `json:"task,omitempty"`
+	Worker  string    `json:"worker,omitempty"`
+	Pod     string    `json:"pod,omitempty"`
+	Message string    `json:"message"`
+}
+
+//eventLog keeps the events of a job, and forwards them as Kubernetes Events on the master pod
+//It has its own lock, so events can be recorded with or without holding the job lock
+type eventLog struct {
+	sync.Mutex
+	events []Event
+	kube   chan Event //Pending Kubernetes Events, nil if we do not know the master pod
+	done   chan bool  //Closed once kube is drained
+}
+
+//taskEvent returns the event for a task update, false if the update is not a transition
+func taskEvent(phase string, taskid int, from, to string, worker, errmsg string) (Event, bool) {
+	ev := Event{Phase: phase, Task: &taskid, Worker: worker}
+	switch {
+	case to == StatusProgress && from == "":
+		ev.Type = EventTaskAcquired
+		ev.Message = fmt.Sprintf("%s task %v acquired by %s", phase, taskid, worker)
+	case to == StatusComplete && from != StatusComplete:
+		ev.Type = EventTaskCompleted
+		ev.Message = fmt.Sprintf("%s task %v completed by %s", phase, taskid, worker)
+	case to == StatusFail && from != StatusFail:
+		ev.Type = EventTaskFailed
+		ev.Message = fmt.Sprintf("%s task %v failed on %s: %s", phase, taskid, worker, errmsg)
+	default:
+		return ev, false
+	}
+	return ev, true
+}
+
+//releaseEvent returns the event for a task taken away from worker
+func releaseEvent(phase string, taskid int, worker string) Event {
+	return Event{
+		Type:    EventTaskReleased,
+		Phase:   phase,
+		Task:    &taskid,
+		Worker:  worker,
+		Message: fmt.Sprintf("%s task %v released from lost worker %s", phase, taskid, worker),
+	}
+}
+
+//record stamps and stores ev
+func (jb *MapReduceJob) record(ev Event) {
+	ev.Time = time.Now()
+	jb.events.Lock()
+	defer jb.events.Unlock()
+	jb.events.events = append(jb.events.events, ev)
+	if jb.events.kube == nil {
+		return
+	}
+	select {
+	case jb.events.kube <- ev:
+	default:
+		log.Warnf("Dropping Kubernetes event: %s", ev.Message)
+	}
+}
+
+//startEvents starts forwarding events to Kubernetes, if we know the master pod
+func (jb *MapReduceJob) startEvents() {
+	if jb.master == nil {
+		return
+	}
+	jb.events.kube = make(chan Event, 100)
+	jb.events.done = make(chan bool)
+	go func() {
+		defer close(jb.events.done)
+		for ev := range jb.events.kube {
+			err := jb.emit(ev)
+			if err != nil {
+				log.Warn(err)
+			}
+		}
+	}()
+}
+
+//stopEvents flushes pending Kubernetes Events
+func (jb *MapReduceJob) stopEvents() {
+	jb.events.Lock()
+	kube := jb.events.kube
+	jb.events.kube = nil
+	jb.events.Unlock()
+	if kube == nil {
+		return
+	}
+	close(kube)
+	<-jb.events.done
+}
+
+//emit creates a Kubernetes Event on the master pod
+func (jb *MapReduceJob) emit(ev Event) error {
+	eventtype := v1.EventTypeNormal
+	if ev.Type == EventTaskFailed || ev.Type == EventPodLost || ev.Phase == StatusFail {
+		eventtype = v1.EventTypeWarning
+	}
+	t := metav1.NewTime(ev.Time)
+	_, err := jb.cl.CoreV1().Events(jb.master.Namespace).Create(&v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			//Same naming as client-go's event recorder
+			Name:      fmt.Sprintf("%v.%x", jb.master.Name, ev.Time.UnixNano()),
+			Namespace: jb.master.Namespace,
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:       "Pod",
+			APIVersion: "v1",
+			Name:       jb.master.Name,
+			Namespace:  jb.master.Namespace,
+			UID:        jb.master.UID,
+		},
+		Reason:         ev.Type,
+		Message:        ev.Message,
+		Type:           eventtype,
+		FirstTimestamp: t,
+		LastTimestamp:  t,
+		Count:          1,
+		Source:         v1.EventSource{Component: "kubemr-" + strings.ToLower(jb.Name)},
+	})
+	return err
+}
+
+func (jb *MapReduceJob) handleEvents(w http.ResponseWriter, r *http.Request) {
+	jb.events.Lock()
+	events := jb.events.events
+	if events == nil {
+		events = []Event{}
+	}
+	j, err := json.Marshal(events)
+	jb.events.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Write(j)
+}
@@ -5,10 +5,23 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/nbari/violetear"
+	"github.com/turbobytes/kubemr/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+//startSpan starts a span for a request, as child of the trace propagated by the worker
+func startSpan(r *http.Request, name string) trace.Span {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	_, span := tracing.Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+	return span
+}
+
 func (jb *MapReduceJob) handleGet(w http.ResponseWriter, r *http.Request) {
 	jb.RLock()
 	defer jb.RUnlock()
@@ -18,11 +31,15 @@ func (jb *MapReduceJob) handleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-type", "application/json")
+	//Let workers hang their spans under the job
+	otel.GetTextMapPropagator().Inject(jb.ctx, propagation.HeaderCarrier(w.Header()))
 	w.Write(j)
 	jb.poke <- true
 }
 
 func (jb *MapReduceJob) handleMap(w http.ResponseWriter, r *http.Request) {
+	span := startSpan(r, "PUT map")
+	defer span.End()
 	jb.Lock()
 	defer jb.Unlock()
 	defer r.Body.Close()
@@ -44,24 +61,48 @@ func (jb *MapReduceJob) handleMap(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	span.SetAttributes(attribute.Int("kubemr.task", taskid), attribute.String("kubemr.worker", task.Worker), attribute.String("kubemr.status", task.Status))
 	//Store the object only if there is no worker assigned, or the worker is the owner
 	obj, found := jb.Maps[taskid]
 	if !found {
 		http.Error(w, fmt.Sprintf("Task %v is not found", taskid), http.StatusNotFound)
 		return
 	}
+	if task.Status == StatusProgress && obj.Status == "" && jb.retired(task.Worker) {
+		http.Error(w, fmt.Sprintf("Worker %s is retired", task.Worker), http.StatusBadRequest)
+		return
+	}
 	if obj.Worker != "" && obj.Worker != task.Worker {
 		//Task exists, and worker is different..
 		//Unsure... bad request or forbidden?
+		jb.metrics.conflicts.WithLabelValues("map").Inc()
 		http.Error(w, fmt.Sprintf("Task %v is already aquired by %s", taskid, obj.Worker), http.StatusBadRequest)
 		return
 	}
+	if task.Status == StatusProgress && (obj.Status == StatusComplete || obj.Status == StatusFail) {
+		//Late progress report
+		http.Error(w, fmt.Sprintf("Task %v is already finished", taskid), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	if task.Progress != nil {
+		task.Progress.Updated = now
+	}
+	//Timing belongs to the master
+	task.TaskTiming = obj.TaskTiming
+	attempt := task.update(task.Worker, obj.Status, task.Status, now)
 	//ok... all good so far...
 	jb.Maps[taskid] = task
+	if ev, ok := taskEvent("map", taskid, obj.Status, task.Status, task.Worker, task.Err); ok {
+		jb.record(ev)
+	}
+	jb.metrics.observe("map", task.Worker, task.Status, attempt, task.BytesRead, task.BytesWritten)
 	jb.poke <- true
 }
 
 func (jb *MapReduceJob) handleReduce(w http.ResponseWriter, r *http.Request) {
+	span := startSpan(r, "PUT reduce")
+	defer span.End()
 	jb.Lock()
 	defer jb.Unlock()
 	defer r.Body.Close()
@@ -83,19 +124,41 @@ func (jb *MapReduceJob) handleReduce(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	span.SetAttributes(attribute.Int("kubemr.task", taskid), attribute.String("kubemr.worker", task.Worker), attribute.String("kubemr.status", task.Status))
 	//Store the object only if there is no worker assigned, or the worker is the owner
 	obj, found := jb.Reduces[taskid]
 	if !found {
 		http.Error(w, fmt.Sprintf("Task %v is not found", taskid), http.StatusNotFound)
 		return
 	}
+	if task.Status == StatusProgress && obj.Status == "" && jb.retired(task.Worker) {
+		http.Error(w, fmt.Sprintf("Worker %s is retired", task.Worker), http.StatusBadRequest)
+		return
+	}
 	if obj.Worker != "" && obj.Worker != task.Worker {
 		//Task exists, and worker is different..
 		//Unsure... bad request or forbidden?
+		jb.metrics.conflicts.WithLabelValues("reduce").Inc()
 		http.Error(w, fmt.Sprintf("Task %v is already aquired by %s", taskid, obj.Worker), http.StatusBadRequest)
 		return
 	}
+	if task.Status == StatusProgress && (obj.Status == StatusComplete || obj.Status == StatusFail) {
+		//Late progress report
+		http.Error(w, fmt.Sprintf("Task %v is already finished", taskid), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	if task.Progress != nil {
+		task.Progress.Updated = now
+	}
+	//Timing belongs to the master
+	task.TaskTiming = obj.TaskTiming
+	attempt := task.update(task.Worker, obj.Status, task.Status, now)
 	//ok... all good so far...
 	jb.Reduces[taskid] = task
+	if ev, ok := taskEvent("reduce", taskid, obj.Status, task.Status, task.Worker, task.Err); ok {
+		jb.record(ev)
+	}
+	jb.metrics.observe("reduce", task.Worker, task.Status, attempt, task.BytesRead, task.BytesWritten)
 	jb.poke <- true
 }
@@ -0,0 +1,261 @@
+package job
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/turbobytes/kubemr/pkg/storage"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+//InputSource is expanded into inputs when the job starts. Exactly one of Prefix, Glob, Manifest or Listing is set
+type InputSource struct {
+	Prefix   string `json:"prefix"`   //s3://bucket/prefix/, every object under it is an input
+	Glob     string `json:"glob"`     //Files matching the glob on a volume mounted at the same path in master and workers, e.g. /data/*.csv
+	Manifest string `json:"manifest"` //s3://, http(s):// URL or path of a file listing one input per line. Blank lines and # comments are skipped
+	Listing  string `json:"listing"`  //http(s) URL of a directory listing, every file linked from it is an input
+	Match    string `json:"match"`    //Optional: Only keep inputs whose last path element matches this glob, e.g. *.gz
+}
+
+//location returns the field and location of the source, along with how many locations are set
+func (src InputSource) location() (string, string, int) {
+	name, location, set := "", "", 0
+	for _, f := range []struct {
+		name  string
+		value string
+	}{{"prefix", src.Prefix}, {"glob", src.Glob}, {"manifest", src.Manifest}, {"listing", src.Listing}} {
+		if f.value != "" {
+			name, location = f.name, f.value
+			set++
+		}
+	}
+	return name, location, set
+}
+
+//validate checks the source without reaching out to it
+func (src InputSource) validate(fld *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	name, location, set := src.location()
+	switch {
+	case set == 0:
+		return append(errs, field.Required(fld, "one of prefix, glob, manifest or listing must be set"))
+	case set > 1:
+		return append(errs, field.Invalid(fld, src, "only one of prefix, glob, manifest or listing may be set"))
+	}
+	switch name {
+	case "prefix":
+		if !strings.HasPrefix(location, "s3://") {
+			errs = append(errs, field.Invalid(fld.Child(name), location, "must be an s3:// URL"))
+		}
+	case "glob":
+		_, err := filepath.Match(location, "")
+		if err != nil {
+			errs = append(errs, field.Invalid(fld.Child(name), location, err.Error()))
+		}
+	case "listing":
+		u, err := url.Parse(location)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, field.Invalid(fld.Child(name), location, "must be an http(s) URL"))
+		}
+	}
+	if src.Match != "" {
+		_, err := path.Match(src.Match, "")
+		if err != nil {
+			errs = append(errs, field.Invalid(fld.Child("match"), src.Match, err.Error()))
+		}
+	}
+	return errs
+}
+
+//discoverInputs appends the inputs found by InputSources to Inputs, skipping those already there
+func (jb *MapReduceJob) discoverInputs() error {
+	seen := make(map[string]bool)
+	for _, input := range jb.Inputs {
+		seen[input] = true
+	}
+	for i, src := range jb.InputSources {
+		inputs, err := jb.discover(src)
+		if err != nil {
+			return fmt.Errorf("inputsources[%v]: %s", i, err)
+		}
+		found := 0
+		for _, input := range inputs {
+			if src.Match != "" {
+				if ok, _ := path.Match(src.Match, path.Base(input)); !ok {
+					continue
+				}
+			}
+			found++
+			if !seen[input] {
+				jb.Inputs = append(jb.Inputs, input)
+				seen[input] = true
+			}
+		}
+		jb.record(Event{Type: EventInputs, Message: fmt.Sprintf("Found %v inputs in inputsources[%v]", found, i)})
+	}
+	if len(jb.Inputs) == 0 {
+		return fmt.Errorf("No inputs found")
+	}
+	return nil
+}
+
+//discover lists the inputs of a single source
+func (jb *MapReduceJob) discover(src InputSource) ([]string, error) {
+	switch {
+	case src.Prefix != "":
+		return jb.discoverPrefix(src.Prefix)
+	case src.Glob != "":
+		matches, err := filepath.Glob(src.Glob)
+		if err != nil {
+			return nil, err
+		}
+		files := make([]string, 0, len(matches))
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				files = append(files, match)
+			}
+		}
+		return files, nil
+	case src.Manifest != "":
+		return jb.discoverManifest(src.Manifest)
+	case src.Listing != "":
+		return discoverListing(src.Listing)
+	}
+	return nil, fmt.Errorf("No source set")
+}
+
+//discoverPrefix lists the objects under an s3:// prefix
+func (jb *MapReduceJob) discoverPrefix(prefix string) ([]string, error) {
+	bucket, key := splitS3(prefix)
+	st, err := jb.config.OpenBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := st.List("/" + key)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]string, 0, len(objects))
+	for _, object := range objects {
+		key := strings.TrimPrefix(object.Key, "/")
+		//Skip folder markers
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+		inputs = append(inputs, "s3://"+bucket+"/"+key)
+	}
+	sort.Strings(inputs)
+	return inputs, nil
+}
+
+//discoverManifest reads the inputs listed in a manifest file
+func (jb *MapReduceJob) discoverManifest(manifest string) ([]string, error) {
+	var rd io.ReadCloser
+	var err error
+	switch {
+	case strings.HasPrefix(manifest, "s3://"):
+		bucket, key := splitS3(manifest)
+		var st storage.Storage
+		st, err = jb.config.OpenBucket(bucket)
+		if err != nil {
+			return nil, err
+		}
+		rd, err = st.Get("/" + key)
+	case strings.HasPrefix(manifest, "http://"), strings.HasPrefix(manifest, "https://"):
+		rd, err = httpGet(manifest)
+	default:
+		rd, err = os.Open(manifest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	inputs := make([]string, 0)
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		inputs = append(inputs, line)
+	}
+	return inputs, scanner.Err()
+}
+
+//listingLink matches links in directory listings
+var listingLink = regexp.MustCompile(`(?i)href\s*=\s*["']([^"']+)["']`)
+
+//discoverListing returns the files linked from an http directory listing, as served by nginx, apache and the like
+func discoverListing(listing string) ([]string, error) {
+	base, err := url.Parse(listing)
+	if err != nil {
+		return nil, err
+	}
+	//Links are relative to the directory
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	rd, err := httpGet(listing)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	b, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, m := range listingLink.FindAllStringSubmatch(string(b), -1) {
+		link, err := base.Parse(m[1])
+		if err != nil {
+			continue
+		}
+		link.Fragment = ""
+		//Only files in this directory, not sorting links, parents or subdirectories
+		if link.Host != base.Host || link.RawQuery != "" || link.Path == base.Path || !strings.HasPrefix(link.Path, base.Path) || strings.HasSuffix(link.Path, "/") {
+			continue
+		}
+		if !seen[link.String()] {
+			inputs = append(inputs, link.String())
+			seen[link.String()] = true
+		}
+	}
+	return inputs, nil
+}
+
+//httpGet returns the body of uri, if it is found
+func httpGet(uri string) (io.ReadCloser, error) {
+	resp, err := http.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned %s", uri, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+//splitS3 splits an s3:// URL into bucket and key, without leading /
+func splitS3(uri string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(uri, "s3://"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
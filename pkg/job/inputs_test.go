@@ -0,0 +1,96 @@
+package job
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/phayes/freeport"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiscoverInputs(t *testing.T) {
+	st := memStorage{
+		"/logs/2026-10-15/a.gz":     []byte("a"),
+		"/logs/2026-10-15/b.gz":     []byte("b"),
+		"/logs/2026-10-15/_SUCCESS": []byte(""),
+		"/logs/2026-10-16/a.gz":     []byte("a"),
+		"/manifest.txt":             []byte("# Extra inputs\nhttps://example.com/x\n\nhttps://example.com/y\n"),
+	}
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"1.csv", "2.csv", "3.txt"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte("foo"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//Like apache
+		fmt.Fprint(w, `<a href="?C=N;O=D">Name</a> <a href="/pub/">Parent Directory</a> <a href="sub/">sub/</a> <A HREF="c.gz">c.gz</A> <a href='d.gz'>d.gz</a>`)
+	}))
+	defer srv.Close()
+	jb := makejob(t)
+	jb.Inputs = []string{"https://example.com/x"}
+	jb.InputSources = []InputSource{
+		{Prefix: "s3://bucket/logs/2026-10-15/", Match: "*.gz"},
+		{Glob: filepath.Join(dir, "*.csv")},
+		{Manifest: "s3://bucket/manifest.txt"},
+		{Listing: srv.URL + "/pub/data"},
+	}
+	if errs := jb.Validate(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	jb.config = testConfig(st)
+	err = jb.discoverInputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"https://example.com/x",
+		"s3://bucket/logs/2026-10-15/a.gz",
+		"s3://bucket/logs/2026-10-15/b.gz",
+		filepath.Join(dir, "1.csv"),
+		filepath.Join(dir, "2.csv"),
+		"https://example.com/y",
+		srv.URL + "/pub/data/c.gz",
+		srv.URL + "/pub/data/d.gz",
+	}
+	if !reflect.DeepEqual(jb.Inputs, expected) {
+		t.Errorf("Expected %v, got %v", expected, jb.Inputs)
+	}
+	//Sources must say where to look, once
+	jb.InputSources = []InputSource{{}, {Prefix: "s3://bucket/a/", Glob: "/data/*"}, {Prefix: "/data/"}}
+	if errs := jb.Validate(); len(errs) != 3 {
+		t.Errorf("Expected 3 errors, got %v", errs)
+	}
+}
+
+//Test Init fails before creating workers when sources find nothing
+func TestDiscoverNothing(t *testing.T) {
+	cl := fake.NewSimpleClientset()
+	jb := makejob(t)
+	jb.Inputs = nil
+	jb.InputSources = []InputSource{{Prefix: "s3://bucket/logs/2026-10-17/"}}
+	err := jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(memStorage{}))
+	if err == nil || !strings.Contains(err.Error(), "No inputs found") {
+		t.Errorf("Expected Init to fail for lack of inputs, got %v", err)
+	}
+	pods, err := cl.CoreV1().Pods("default").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("Expected no workers, got %v", len(pods.Items))
+	}
+}
@@ -2,6 +2,7 @@ package job
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,18 +10,36 @@ import (
 	"time"
 
 	"github.com/nbari/violetear"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
-	shortid "github.com/ventu-io/go-shortid"
-	batchv1 "k8s.io/api/batch/v1"
+	"github.com/turbobytes/kubemr/pkg/k8s"
+	"github.com/turbobytes/kubemr/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
+//ErrTimeout is returned by Start when the job does not finish in time
+var ErrTimeout = errors.New("Job timed out")
+
+//DefaultReplicas is the number of workers started when replicas is not set
+const DefaultReplicas = 1
+
 var (
-	defaultreplica int32 = 1
+	defaultreplica     int32 = DefaultReplicas
+	defaultmaxrestarts int32 = 3
 )
 
+//Length of generated run IDs
+const runIDLength = 10
+
 const (
 	//StatusFail when job fails
 	StatusFail = "FAIL"
@@ -43,39 +62,96 @@ const (
 // MapReduceJob defines TPR object for a map-reduce job
 type MapReduceJob struct {
 	*sync.RWMutex
-	Name      string             `json:"name"`      //Name generated by system
-	Namespace string             `json:"namespace"` //Name generated by system
-	Status    string             `json:"status"`    //Status of the job
-	Err       string             `json:"error"`     //Errors, if any
-	Maps      map[int]MapTask    `json:"maps"`
-	Reduces   map[int]ReduceTask `json:"reduces"`
-	Results   []string           `json:"results"`
-	Replicas  *int32             `json:"replicas"` //Number of workers to run in parallel
-	Inputs    []string           `json:"inputs"`   //List of initial inputs for the map phase
+	Name        string             `json:"name"`      //Name generated by system
+	Namespace   string             `json:"namespace"` //Name generated by system
+	Status      string             `json:"status"`    //Status of the job
+	Err         string             `json:"error"`     //Errors, if any
+	Maps        map[int]MapTask    `json:"maps"`
+	Reduces     map[int]ReduceTask `json:"reduces"`
+	Results     []ResultPart       `json:"results"`     //Ordered by partition
+	Output      string             `json:"output"`      //Key prefix in the bucket results are published to, defaults to output/ under the run prefix
+	Counters    Counters           `json:"counters"`    //Sum of counters reported by tasks
+	Estimate    *Estimate          `json:"estimate"`    //When the current phase is expected to finish
+	Summary     *Summary           `json:"summary"`     //Timing breakdown, once the job is over
+	Replicas    *int32             `json:"replicas"`    //Number of workers to start with
+	MinReplicas *int32             `json:"minreplicas"` //Fewest workers to keep, defaults to 1
+	MaxReplicas *int32             `json:"maxreplicas"` //Most workers to run while tasks are pending, defaults to the largest starting fleet
+	//Optional: Phase specific workers. When any is set, the map workers are replaced by reduce workers at the end of the map phase
+	MapReplicas    *int32              `json:"mapreplicas"`
+	ReduceReplicas *int32              `json:"reducereplicas"`
+	MapTemplate    *v1.PodTemplateSpec `json:"maptemplate"`
+	ReduceTemplate *v1.PodTemplateSpec `json:"reducetemplate"`
+	Retire         []string            `json:"retire"`       //Workers told to exit once idle
+	MaxRestarts    *int32              `json:"maxrestarts"`  //Worker pods that may be created to replace failed or deleted ones
+	Restarts       int32               `json:"restarts"`     //Worker pods replaced so far
+	Inputs         []string            `json:"inputs"`       //List of initial inputs for the map phase
+	InputSources   []InputSource       `json:"inputsources"` //Expanded into more inputs when the job starts
 	//UserSecretName string              `json:"usersecretname"` //Optional: Name of secret in job's namespace to be available to worker
 	Template v1.PodTemplateSpec `json:"template"` //Pod template for the job
-	server   *http.Server
-	poke     chan bool
-	cl       kubernetes.Interface //k8s client to do Kubernetes things
-	addr     string
-	config   *Config
-	jobname  string //Store the job name generated by kubernetes
-	uuid     string
+	//Optional: Name of the pod running the master, in Namespace. Events are reported on this pod
+	MasterPod        string `json:"masterpod"`
+	WorkerNamespace  string `json:"workernamespace"`  //Optional: Namespace of the worker pods, defaults to Namespace
+	WorkerKubeconfig string `json:"workerkubeconfig"` //Optional: kubeconfig of the cluster running the workers, defaults to the master's
+	AdvertiseURL     string `json:"advertiseurl"`     //Optional: Where workers reach the master, e.g. a Service. Defaults to the master's IP
+	ServiceType      string `json:"servicetype"`      //Optional: ClusterIP or Headless to put a Service in front of the master. Requires masterpod
+	NetworkPolicy    bool   `json:"networkpolicy"`    //Optional: Only let worker pods reach the master, along with the Service
+	//Optional: Also let these reach the master along with the workers, e.g. a namespaceSelector of the monitoring namespace to scrape /metrics
+	NetworkPolicyFrom []networkingv1.NetworkPolicyPeer `json:"networkpolicyfrom"`
+	CleanupPolicy     string                           `json:"cleanuppolicy"` //OnSuccess, Always or Never delete what task attempts wrote once the job is over. Defaults to OnSuccess
+	//Allow, Forbid or Replace other runs of the same name. Defaults to Allow
+	ConcurrencyPolicy string `json:"concurrencypolicy"`
+	RunID             string `json:"runid"` //Tells runs of the same job apart, generated unless set
+	server            *http.Server
+	poke              chan bool
+	abort             chan string          //Why the job is aborted
+	cl                kubernetes.Interface //k8s client to do Kubernetes things
+	workercl          kubernetes.Interface //k8s client of the cluster running the workers
+	service           string               //Name of the Service in front of the master, if any
+	policy            string               //Name of the NetworkPolicy protecting the master, if any
+	addr              string
+	config            *Config
+	jobname           string //Store the job name generated by kubernetes
+	metrics           *jobMetrics
+	ctx               context.Context //Carries the span covering the whole job
+	span              trace.Span
+	phase             trace.Span //Span of the current phase
+	//When the current phase started
+	phaseStarted time.Time
+	phaseTimes   map[string]time.Time //When the job entered each status
+	master       *v1.Pod              //The pod running the master, nil if unknown
+	events       eventLog
+	watchStop    chan struct{}   //Closed to stop watching worker pods
+	live         map[string]bool //Worker pods neither lost nor retired
+	creating     int             //Replacement worker pods being created without holding the lock, they count as live
+	published    chan bool       //Closed once publishing results is over, nil until it starts
 }
 
 //Init initializes the job, setting sane defaults
-func (jb *MapReduceJob) Init(cl kubernetes.Interface, addr, myip string, cfg *Config) error {
+func (jb *MapReduceJob) Init(cl kubernetes.Interface, addr, myip string, cfg *Config) (err error) {
 	jb.cl = cl
 	jb.RWMutex = &sync.RWMutex{}
-	//Generate uuid... we use this in url to prevent possible cross-job contamination
-	var err error
-	jb.uuid, err = shortid.Generate()
-	if err != nil {
-		return err
+	//Generate run ID... we use this in url, labels and storage to keep runs of the same job apart
+	if jb.RunID == "" {
+		jb.RunID = utilrand.String(runIDLength)
 	}
-	//Validate name
-	if jb.Name == "" {
-		return fmt.Errorf("A name must be provided")
+	jb.ctx, jb.span = tracing.Tracer().Start(context.Background(), "job", trace.WithAttributes(
+		attribute.String("kubemr.job", jb.Name),
+		attribute.String("kubemr.run", jb.RunID),
+	))
+	ctx, span := tracing.Tracer().Start(jb.ctx, "Init")
+	defer func() {
+		tracing.EndSpan(span, err)
+		if err != nil {
+			//Start will never be called
+			tracing.EndSpan(jb.span, err)
+			jb.stopEvents()
+		}
+	}()
+	//Report every problem at once
+	errs := jb.Validate()
+	errs = append(errs, cfg.ValidateFields(field.NewPath("config"))...)
+	if len(errs) > 0 {
+		return errs.ToAggregate()
 	}
 	//Stamp unique name
 	//jb.Name = jb.Name + "-" + strings.ToLower(s)
@@ -83,82 +159,162 @@ func (jb *MapReduceJob) Init(cl kubernetes.Interface, addr, myip string, cfg *Co
 	if jb.Replicas == nil {
 		jb.Replicas = &defaultreplica
 	}
+	if jb.MinReplicas == nil {
+		jb.MinReplicas = &defaultreplica
+	}
+	if jb.MaxReplicas == nil {
+		mapreplicas, reducereplicas := jb.replicas(jb.fleet(StatusMap)), jb.replicas(jb.fleet(StatusReduce))
+		maxreplicas := mapreplicas
+		if reducereplicas > maxreplicas {
+			maxreplicas = reducereplicas
+		}
+		jb.MaxReplicas = &maxreplicas
+	}
+	if jb.MaxRestarts == nil {
+		jb.MaxRestarts = &defaultmaxrestarts
+	}
+	if jb.CleanupPolicy == "" {
+		jb.CleanupPolicy = CleanupOnSuccess
+	}
+	jb.live = make(map[string]bool)
 	jb.Maps = make(map[int]MapTask)
 	jb.Reduces = make(map[int]ReduceTask)
-	//if jb.Template == nil {
-	//return fmt.Errorf("Template not provided")
-	//}
-	if jb.Inputs == nil || len(jb.Inputs) == 0 {
-		return fmt.Errorf("Inputs not provided")
-	}
+	jb.phaseTimes = make(map[string]time.Time)
+	jb.metrics = newJobMetrics(jb)
 	if jb.Namespace == "" {
 		jb.Namespace = "default"
 	}
+	if jb.WorkerNamespace == "" {
+		jb.WorkerNamespace = jb.Namespace
+	}
+	jb.workercl = cl
+	if jb.WorkerKubeconfig != "" {
+		var config *rest.Config
+		config, err = k8s.GetConfig("", jb.WorkerKubeconfig)
+		if err != nil {
+			return err
+		}
+		jb.workercl, err = k8s.GetKubernetes(config)
+		if err != nil {
+			return err
+		}
+	}
+	jb.jobname = strings.ToLower(jb.Name)
+	if jb.MasterPod != "" {
+		jb.master, err = cl.CoreV1().Pods(jb.Namespace).Get(jb.MasterPod, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	if jb.ConcurrencyPolicy == "" {
+		jb.ConcurrencyPolicy = ConcurrencyAllow
+	}
+	jb.startEvents()
 	jb.poke = make(chan bool, 10) //Creating some buffer otherwise unlock defer doesnt work when channel is full
+	jb.abort = make(chan string, 1)
 	jb.addr = addr
-	//Populate the config"/" + jb.Name + "/" + jb.uuid + "/"
-	cfg.JobURL = fmt.Sprintf("http://%s%s/%s/%s/", myip, addr, jb.Name, jb.uuid)
 	if !strings.HasSuffix(cfg.BucketPrefix, "/") {
 		cfg.BucketPrefix = cfg.BucketPrefix + "/"
 	}
-	cfg.BucketPrefix = cfg.BucketPrefix + jb.Name + "/"
+	//Keys must start with / so object URIs read s3://bucket/key
+	if !strings.HasPrefix(cfg.BucketPrefix, "/") {
+		cfg.BucketPrefix = "/" + cfg.BucketPrefix
+	}
+	cfg.BucketPrefix = cfg.BucketPrefix + jb.Name + "/" + jb.RunID + "/"
+	if jb.Output == "" {
+		jb.Output = cfg.BucketPrefix + "output/"
+	}
+	if !strings.HasSuffix(jb.Output, "/") {
+		jb.Output = jb.Output + "/"
+	}
+	if !strings.HasPrefix(jb.Output, "/") {
+		jb.Output = "/" + jb.Output
+	}
 	jb.config = cfg
-	return jb.deployk8()
-}
-
-//deploy the batch job
-func (jb *MapReduceJob) deployk8() error {
-	//Hmm... instead of spamming k8 with secrets we let user handle KUBEMR_S3_ACCESS_KEY_ID and KUBEMR_S3_SECRET_ACCESS_KEY
-	//Annotate the podspec
-	podspec := jb.Template
-	podspec.Spec.RestartPolicy = v1.RestartPolicyOnFailure
-	//Create Batch job...
-	for i := range podspec.Spec.Containers {
-		podspec.Spec.Containers[i].Env = append(podspec.Spec.Containers[i].Env, stampCommonEnv(jb.config)...)
-	}
-	//Prepare the batch job
-	jobspec := batchv1.Job{
-		//Metadata
-		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: jb.Name + "-",
-			Namespace:    jb.Namespace,
-		},
-		//Jobspec
-		Spec: batchv1.JobSpec{
-			Parallelism: jb.Replicas,
-			//Pod template
-			Template: podspec,
-		},
-	}
-	//jb.jobname = jb.Name + "-" + jb.uuid
-	jb.jobname = strings.ToLower(jb.Name)
-	pod := &v1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: jb.jobname + "-",
-			Namespace:    jobspec.Namespace,
-			Labels: map[string]string{
-				"job-name": jb.jobname,
-			},
-		},
-		Spec: jobspec.Spec.Template.Spec,
-	}
-	pod.Spec.RestartPolicy = v1.RestartPolicyNever
-	for i := 0; i < int(*jb.Replicas); i++ {
-		p, err := jb.cl.CoreV1().Pods(jobspec.Namespace).Create(pod)
+	//Storage and inputs are checked before touching the cluster, there is nothing to run without them
+	err = jb.ExpandInputs(cfg.OpenBucket)
+	if err != nil {
+		return fmt.Errorf("Unable to expand inputs: %s", err)
+	}
+	err = jb.checkOutput()
+	if err != nil {
+		return err
+	}
+	err = jb.discoverInputs()
+	if err != nil {
+		return fmt.Errorf("Unable to discover inputs: %s", err)
+	}
+	if jb.master != nil {
+		err = jb.labelMaster()
 		if err != nil {
 			return err
 		}
-		log.Infof("Created job: %s", p.Name)
 	}
-	//Deploy the job...
-	/*
-		j, err := jb.cl.BatchV1().Jobs(jobspec.Namespace).Create(&jobspec)
+	err = jb.checkConcurrency()
+	if err != nil {
+		return err
+	}
+	//From here on we create things, delete them again if we do not get to start
+	defer func() {
+		if err != nil {
+			cleanupErr := jb.cleanup()
+			if cleanupErr != nil {
+				log.Error(cleanupErr)
+			}
+		}
+	}()
+	//Populate the config"/" + jb.Name + "/" + jb.RunID + "/"
+	cfg.JobURL = fmt.Sprintf("http://%s%s/%s/%s/", myip, addr, jb.Name, jb.RunID)
+	if jb.ServiceType != "" {
+		var hostport string
+		hostport, err = jb.exposeMaster(addr)
 		if err != nil {
 			return err
 		}
-		jb.jobname = j.Name
-		log.Infof("Created job: %s", j.Name)
-	*/
+		cfg.JobURL = fmt.Sprintf("http://%s/%s/%s/", hostport, jb.Name, jb.RunID)
+	}
+	if jb.AdvertiseURL != "" {
+		cfg.JobURL = fmt.Sprintf("%s/%s/%s/", strings.TrimSuffix(jb.AdvertiseURL, "/"), jb.Name, jb.RunID)
+	}
+	return jb.deployk8(ctx)
+}
+
+//setStatus moves the job to status, recording an event and tracing the map and reduce phases
+func (jb *MapReduceJob) setStatus(status string) {
+	jb.Status = status
+	jb.phaseStarted = time.Now()
+	jb.phaseTimes[status] = jb.phaseStarted
+	if status == StatusComplete || status == StatusFail {
+		jb.Summary = jb.summarize(jb.phaseStarted)
+	}
+	jb.endPhaseSpan()
+	switch status {
+	case StatusMap, StatusReduce:
+		_, jb.phase = tracing.Tracer().Start(jb.ctx, strings.ToLower(status))
+	}
+	jb.record(Event{Type: EventStatus, Phase: status, Message: "Job is now " + status})
+}
+
+func (jb *MapReduceJob) endPhaseSpan() {
+	if jb.phase != nil {
+		jb.phase.End()
+		jb.phase = nil
+	}
+}
+
+//deploy the worker pods
+func (jb *MapReduceJob) deployk8(ctx context.Context) (err error) {
+	_, span := tracing.Tracer().Start(ctx, "deployk8")
+	defer func() { tracing.EndSpan(span, err) }()
+	fleet := jb.fleet(StatusMap)
+	for i := int32(0); i < jb.replicas(fleet); i++ {
+		var p *v1.Pod
+		p, err = jb.createWorker(fleet)
+		if err != nil {
+			return err
+		}
+		jb.live[p.Name] = true
+	}
 	return nil
 }
 
@@ -168,21 +324,11 @@ func (jb *MapReduceJob) Start(timeout time.Duration) error {
 	for i, input := range jb.Inputs {
 		jb.Maps[i] = MapTask{Input: input}
 	}
-
 	//FAKE status
-	jb.Status = StatusMap
-	router := violetear.New()
-	//router.LogRequests = true
-	router.RequestID = "Request-ID"
-	router.AddRegex(":taskid", `[0-9]+`) //String one or more chr
-
-	//Get the whole job
-	base := "/" + jb.Name + "/" + jb.uuid + "/"
-	router.HandleFunc(base, jb.handleGet, "GET")
-	router.HandleFunc(base+"map/:taskid/", jb.handleMap, "PUT")
-	router.HandleFunc(base+"reduce/:taskid/", jb.handleReduce, "PUT")
+	jb.setStatus(StatusMap)
+	jb.watchWorkers()
 	jb.server = &http.Server{
-		Handler:        router,
+		Handler:        jb.router(),
 		Addr:           jb.addr,
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   60 * time.Second,
@@ -190,48 +336,81 @@ func (jb *MapReduceJob) Start(timeout time.Duration) error {
 	}
 	//How to send err?
 	go jb.server.ListenAndServe()
+	log.Infof("Dashboard at %sui/", jb.config.JobURL)
 	return jb.wait(timeout)
 }
 
-func (jb *MapReduceJob) stop() {
+//router routes the http API of the job
+func (jb *MapReduceJob) router() http.Handler {
+	router := violetear.New()
+	//router.LogRequests = true
+	router.RequestID = "Request-ID"
+	router.AddRegex(":taskid", `[0-9]+`) //String one or more chr
+
+	//Get the whole job
+	base := "/" + jb.Name + "/" + jb.RunID + "/"
+	router.HandleFunc(base, jb.handleGet, "GET")
+	router.HandleFunc(base+"map/:taskid/", jb.handleMap, "PUT")
+	router.HandleFunc(base+"reduce/:taskid/", jb.handleReduce, "PUT")
+	//Human friendly view of the job
+	router.HandleFunc(base+"ui/", jb.handleDashboard, "GET")
+	router.HandleFunc(base+"events/", jb.handleEvents, "GET")
+	//Prometheus metrics
+	router.HandleFunc("/metrics", promhttp.HandlerFor(jb.metrics.registry, promhttp.HandlerOpts{}).ServeHTTP, "GET")
+	return router
+}
+
+func (jb *MapReduceJob) stop(joberr error) {
+	jb.endPhaseSpan()
+	defer tracing.EndSpan(jb.span, joberr)
 	log.Info("Stopping server")
 	err := jb.server.Shutdown(context.Background())
 	if err != nil {
 		log.Error(err)
 	}
+	jb.stopWatcher()
+	jb.RLock()
+	published := jb.published
+	jb.RUnlock()
+	//Publishing copies what cleanupStorage deletes, and retracts the results if the job failed meanwhile
+	if published != nil {
+		<-published
+	}
 	err = jb.cleanup() //Remove k8s resources
 	if err != nil {
 		log.Error(err)
 	}
+	err = jb.cleanupStorage(joberr) //Remove intermediate outputs
+	if err != nil {
+		log.Error(err)
+	}
+	jb.stopEvents()
 }
 
+//cleanup deletes the Kubernetes resources of the job, carrying on past errors
 func (jb *MapReduceJob) cleanup() error {
-	//Delete the batch job in k8s
+	errs := make([]error, 0)
+	//Delete the worker pods, those that went away with the master are garbage collected by Kubernetes
 	if jb.jobname != "" {
-		log.Info("Deleting batch job")
-		/*
-			policy := metav1.DeletePropagationForeground
-			err := jb.cl.BatchV1().Jobs(jb.Namespace).Delete(jb.jobname, &metav1.DeleteOptions{PropagationPolicy: &policy})
-			if err != nil {
-				return err
-			}
-		*/
-		//hunt for lingering pods...
-
-		pods, err := jb.cl.CoreV1().Pods(jb.Namespace).List(metav1.ListOptions{LabelSelector: "job-name=" + jb.jobname})
+		log.Info("Deleting worker pods")
+		pods, err := jb.workerPods().List(metav1.ListOptions{LabelSelector: jb.workerSelector()})
 		if err != nil {
-			return err
-		}
-		for _, pod := range pods.Items {
-			err = jb.cl.CoreV1().Pods(jb.Namespace).Delete(pod.Name, &metav1.DeleteOptions{})
-			if err != nil {
-				return err
+			errs = append(errs, err)
+		} else {
+			for _, pod := range pods.Items {
+				err = jb.deleteWorker(pod.Name)
+				if err != nil {
+					errs = append(errs, err)
+				}
 			}
+			jb.jobname = ""
 		}
-		jb.jobname = ""
-
 	}
-	return nil
+	err := jb.unexposeMaster()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
 }
 
 //Single loop of checking job status
@@ -239,6 +418,8 @@ func (jb *MapReduceJob) jobloop() (bool, error) {
 	jb.Lock()
 	defer jb.Unlock()
 	//log.Info(jb.Status)
+	jb.aggregateCounters()
+	jb.Estimate = jb.estimate()
 	switch jb.Status {
 	case "":
 		//Should not be
@@ -259,8 +440,8 @@ func (jb *MapReduceJob) jobloop() (bool, error) {
 		for taskid, m := range jb.Maps {
 			if m.Status == StatusFail {
 				//One of the maps had a fail... Fail the whole job
-				jb.Status = StatusFail
 				jb.Err = fmt.Sprintf("MAP: Worker: %s, Task: %v, Err: %s", m.Worker, taskid, m.Err)
+				jb.setStatus(StatusFail)
 				return true, fmt.Errorf(jb.Err)
 			}
 			alldone = alldone && m.Status == StatusComplete
@@ -275,36 +456,46 @@ func (jb *MapReduceJob) jobloop() (bool, error) {
 			for taskid, inputs := range reduces {
 				jb.Reduces[taskid] = ReduceTask{Inputs: inputs}
 			}
-			jb.Status = StatusReduce
+			jb.setStatus(StatusReduce)
+			err := jb.switchFleet()
+			if err != nil {
+				jb.Err = fmt.Sprintf("Unable to start reduce workers: %s", err)
+				jb.setStatus(StatusFail)
+				return true, err
+			}
 		}
 	case StatusReduce:
 		//Check if its finished or err
 		alldone := true
-		results := make([]string, 0)
 		for taskid, r := range jb.Reduces {
 			if r.Status == StatusFail {
 				//One of the maps had a fail... Fail the whole job
-				jb.Status = StatusFail
 				jb.Err = fmt.Sprintf("REDUCE: Worker: %s, Task: %v, Err: %s", r.Worker, taskid, r.Err)
+				jb.setStatus(StatusFail)
 				return true, fmt.Errorf(jb.Err)
 			}
 			alldone = alldone && r.Status == StatusComplete
-			if r.Output != "" {
-				results = append(results, r.Output)
-			}
 		}
 		if alldone {
-			jb.Status = StatusComplete
-			jb.Results = results
-			return true, nil
+			//Publishing copies objects, it must not hold up the handlers or the timeout
+			if jb.published == nil {
+				jb.published = make(chan bool)
+				reduces := make(map[int]ReduceTask, len(jb.Reduces))
+				for id, task := range jb.Reduces {
+					reduces[id] = task
+				}
+				go jb.publish(reduces)
+			}
+			return false, nil
 		}
 	}
+	jb.scale()
 	return false, nil
 }
 
 //Wait until job is ober...
-func (jb *MapReduceJob) wait(timeout time.Duration) error {
-	defer jb.stop() //Stop the server once we exit...
+func (jb *MapReduceJob) wait(timeout time.Duration) (err error) {
+	defer func() { jb.stop(err) }() //Stop the server once we exit...
 	defer close(jb.poke)
 	t := time.After(timeout)
 	for {
@@ -316,28 +507,92 @@ func (jb *MapReduceJob) wait(timeout time.Duration) error {
 				return err
 			}
 		case <-t:
-			return fmt.Errorf("Job timed out after %s", timeout)
+			return jb.fail(fmt.Sprintf("Job timed out after %s", timeout), ErrTimeout)
+		case reason := <-jb.abort:
+			return jb.fail(reason, errors.New(reason))
 		}
 	}
 }
 
+//fail fails the job with reason and returns err, unless publishing completed it before its poke got to us
+func (jb *MapReduceJob) fail(reason string, err error) error {
+	jb.Lock()
+	defer jb.Unlock()
+	if jb.Status == StatusComplete {
+		return nil
+	}
+	jb.Err = reason
+	jb.setStatus(StatusFail)
+	return err
+}
+
+//Abort fails the job with reason, Start returns once the workers and the rest of the job are cleaned up
+//Workers without an owner, e.g. when the master runs outside the cluster, are only deleted this way
+func (jb *MapReduceJob) Abort(reason string) {
+	select {
+	case jb.abort <- reason:
+	default: //Already aborting
+	}
+}
+
+//Counters holds the counters reported by tasks, summed per phase and for the whole job
+type Counters struct {
+	Map    map[string]int64 `json:"map"`
+	Reduce map[string]int64 `json:"reduce"`
+	Total  map[string]int64 `json:"total"`
+}
+
+func addCounters(dst, src map[string]int64) {
+	for k, v := range src {
+		dst[k] += v
+	}
+}
+
+//aggregateCounters recomputes jb.Counters from the tasks
+func (jb *MapReduceJob) aggregateCounters() {
+	c := Counters{
+		Map:    make(map[string]int64),
+		Reduce: make(map[string]int64),
+		Total:  make(map[string]int64),
+	}
+	for _, m := range jb.Maps {
+		addCounters(c.Map, m.Counters)
+	}
+	for _, r := range jb.Reduces {
+		addCounters(c.Reduce, r.Counters)
+	}
+	addCounters(c.Total, c.Map)
+	addCounters(c.Total, c.Reduce)
+	jb.Counters = c
+}
+
 //Result describes the final result to be consumed by the user
 type Result string
 
 //ReduceTask holds the values for individual map task
 type ReduceTask struct {
-	Worker string   `json:"worker"` //Hostname, used for locking
-	Inputs []string `json:"inputs"` //Multiple possible inputs for a reduce job
-	Output string   `json:"output"` //Single output from reduce
-	Err    string   `json:"error"`
-	Status string   `json:"status"`
+	Worker       string           `json:"worker"` //Hostname, used for locking
+	Inputs       []string         `json:"inputs"` //Multiple possible inputs for a reduce job
+	Output       string           `json:"output"` //Single output from reduce
+	Err          string           `json:"error"`
+	Status       string           `json:"status"`
+	BytesRead    int64            `json:"bytesread"`          //Reported by worker
+	BytesWritten int64            `json:"byteswritten"`       //Reported by worker
+	Counters     map[string]int64 `json:"counters,omitempty"` //Incremented by user code
+	Progress     *Progress        `json:"progress,omitempty"` //Last progress reported while running
+	TaskTiming
 }
 
 //MapTask holds the values for individual map task
 type MapTask struct {
-	Worker  string         `json:"worker"`  //Hostname, used for locking
-	Input   string         `json:"input"`   //One input per map
-	Outputs map[int]string `json:"outputs"` //Multiple possible outputs
-	Err     string         `json:"error"`
-	Status  string         `json:"status"`
+	Worker       string           `json:"worker"`  //Hostname, used for locking
+	Input        string           `json:"input"`   //One input per map
+	Outputs      map[int]string   `json:"outputs"` //Multiple possible outputs
+	Err          string           `json:"error"`
+	Status       string           `json:"status"`
+	BytesRead    int64            `json:"bytesread"`          //Reported by worker
+	BytesWritten int64            `json:"byteswritten"`       //Reported by worker
+	Counters     map[string]int64 `json:"counters,omitempty"` //Incremented by user code
+	Progress     *Progress        `json:"progress,omitempty"` //Last progress reported while running
+	TaskTiming
 }
@@ -2,15 +2,26 @@ package job
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/phayes/freeport"
+	"github.com/turbobytes/kubemr/pkg/storage"
 
+	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func makejob(t *testing.T) *MapReduceJob {
@@ -66,29 +77,87 @@ func gethttp(method, url, body string, t *testing.T) int {
 	return resp.StatusCode
 }
 
+//readhttp returns the body of a GET on url, failing unless the status is 200
+func readhttp(url string, t *testing.T) string {
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("%s returned status %v", url, resp.StatusCode)
+	}
+	return string(b)
+}
+
 //Test normal workflow...
 func TestMRJobFlowOK(t *testing.T) {
-	cl := fake.NewSimpleClientset()
+	//Pretend to run inside the master pod
+	cl := fake.NewSimpleClientset(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "master", Namespace: "default"}})
 	addr := fmt.Sprintf(":%v", freeport.GetPort())
 	t.Log(addr)
 	jb := makejob(t)
-	err := jb.Init(cl, addr, "127.0.0.1", &Config{})
+	jb.MasterPod = "master"
+	st := memStorage{}
+	err := jb.Init(cl, addr, "127.0.0.1", testConfig(st))
 	if err != nil {
 		t.Error(err)
 	}
+	//Workers should be owned by the master pod
+	pods, err := cl.CoreV1().Pods("default").List(metav1.ListOptions{LabelSelector: "job-name=foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) == 0 {
+		t.Error("Expected worker pods")
+	}
+	for _, pod := range pods.Items {
+		if len(pod.OwnerReferences) != 1 || pod.OwnerReferences[0].Name != "master" || pod.OwnerReferences[0].BlockOwnerDeletion != nil {
+			t.Errorf("Expected worker pod %s to be owned by master, got %v", pod.Name, pod.OwnerReferences)
+		}
+	}
 	errch := make(chan error)
 	go func() {
 		//TODO: Need better way than stupid sleep...
 		time.Sleep(time.Millisecond * 30)
-		baseurl := fmt.Sprintf("http://127.0.0.1%s/%s/%s/", addr, jb.Name, jb.uuid)
+		baseurl := fmt.Sprintf("http://127.0.0.1%s/%s/%s/", addr, jb.Name, jb.RunID)
 		t.Log(baseurl)
 		if gethttp(http.MethodGet, baseurl, "", t) != 200 {
 			errch <- fmt.Errorf("%s returned status not 200", baseurl)
 		}
-		if gethttp(http.MethodPut, baseurl+"map/0", `{"worker":"foo","input":"a","outputs":{"1":"a","2":"b"},"error":"","status":"COMPLETE"}`, t) != 200 {
+		dashboard := readhttp(baseurl+"ui/", t)
+		for _, row := range []string{
+			"<h2>Map: 0/3</h2>",
+			`<tr><td>0</td><td class="PENDING">PENDING</td>`,
+			`<tr><td>2</td><td class="PENDING">PENDING</td>`,
+			"<h2>Reduce: 0/0</h2>",
+		} {
+			if !strings.Contains(dashboard, row) {
+				errch <- fmt.Errorf("Expected %s on the dashboard, got\n%s", row, dashboard)
+			}
+		}
+		if gethttp(http.MethodGet, baseurl+"events/", "", t) != 200 {
+			errch <- fmt.Errorf("%s returned status not 200", baseurl+"events/")
+		}
+		if gethttp(http.MethodGet, fmt.Sprintf("http://127.0.0.1%s/metrics", addr), "", t) != 200 {
+			errch <- fmt.Errorf("/metrics returned status not 200")
+		}
+		if gethttp(http.MethodPut, baseurl+"map/0", `{"worker":"foo","input":"a","status":"PROGRESS","progress":{"fraction":0.5}}`, t) != 200 {
 			errch <- fmt.Errorf("%s returned status not 200", baseurl+"map/0")
 		}
-		if gethttp(http.MethodPut, baseurl+"map/1", `{"worker":"foo","input":"a","outputs":{"1":"c","2":"d"},"error":"","status":"COMPLETE"}`, t) != 200 {
+		if gethttp(http.MethodPut, baseurl+"map/0", `{"worker":"foo","input":"a","outputs":{"1":"a","2":"b"},"error":"","status":"COMPLETE","counters":{"records":2}}`, t) != 200 {
+			errch <- fmt.Errorf("%s returned status not 200", baseurl+"map/0")
+		}
+		//Progress reports after completion are rejected
+		if gethttp(http.MethodPut, baseurl+"map/0", `{"worker":"foo","input":"a","status":"PROGRESS","progress":{"fraction":0.9}}`, t) != 400 {
+			errch <- fmt.Errorf("%s late progress did not return status 400", baseurl+"map/0")
+		}
+		if gethttp(http.MethodPut, baseurl+"map/1", `{"worker":"foo","input":"a","outputs":{"1":"c","2":"d"},"error":"","status":"COMPLETE","counters":{"records":3},"bytesread":100}`, t) != 200 {
 			errch <- fmt.Errorf("%s returned status not 200", baseurl+"map/1")
 		}
 		if gethttp(http.MethodPut, baseurl+"map/2", `{"worker":"foo","input":"a","outputs":{"1":"e","2":"f"},"error":"","status":"COMPLETE"}`, t) != 200 {
@@ -102,6 +171,21 @@ func TestMRJobFlowOK(t *testing.T) {
 		if len(jb.Reduces) != 2 {
 			errch <- fmt.Errorf("Expected 2 reduce tasks, got %v", len(jb.Reduces))
 		}
+		if len(jb.Maps[0].Attempts) != 1 || jb.Maps[0].Finished == nil {
+			errch <- fmt.Errorf("Expected one finished attempt on map 0, got %+v", jb.Maps[0].TaskTiming)
+		}
+		if jb.Counters.Map["records"] != 5 {
+			errch <- fmt.Errorf("Expected 5 records counted in map phase, got %v", jb.Counters.Map["records"])
+		}
+		metrics := readhttp(fmt.Sprintf("http://127.0.0.1%s/metrics", addr), t)
+		for _, series := range []string{
+			`kubemr_tasks{kubemr_job="foo",phase="map",status="COMPLETE"} 3`,
+			`kubemr_job_reported_bytes_total{direction="read",kubemr_job="foo",phase="map"} 100`,
+		} {
+			if !strings.Contains(metrics, series+"\n") {
+				errch <- fmt.Errorf("Expected %s in /metrics, got\n%s", series, metrics)
+			}
+		}
 		//Do the reduce tasks...
 		if gethttp(http.MethodPut, baseurl+"reduce/1", `{"worker":"foo","inputs":["a","c","e"],"output":"foo","error":"","status":"COMPLETE"}`, t) != 200 {
 			errch <- fmt.Errorf("%s returned status not 200", baseurl+"reduce/1")
@@ -114,11 +198,17 @@ func TestMRJobFlowOK(t *testing.T) {
 		if jb.Status != StatusComplete {
 			errch <- fmt.Errorf("Expected completed stage, got %s", jb.Status)
 		}
-		if jb.Results[0] != "foo" {
-			errch <- fmt.Errorf("First result should be foo, got %s", jb.Results[0])
+		if jb.Summary == nil || jb.Summary.Workers["foo"] == nil || jb.Summary.Workers["foo"].Tasks != 5 {
+			errch <- fmt.Errorf("Expected a summary with 5 tasks done by foo, got %+v", jb.Summary)
+		}
+		if _, ok := st[jb.Output+"_SUCCESS"]; !ok {
+			errch <- fmt.Errorf("Expected _SUCCESS manifest in %s", jb.Output)
+		}
+		if jb.Results[0].URI != "foo" || jb.Results[0].Partition != 1 {
+			errch <- fmt.Errorf("First result should be foo of partition 1, got %+v", jb.Results[0])
 		}
-		if jb.Results[1] != "bar" {
-			errch <- fmt.Errorf("Second result should be bar, got %s", jb.Results[1])
+		if jb.Results[1].URI != "bar" || jb.Results[1].Partition != 2 {
+			errch <- fmt.Errorf("Second result should be bar of partition 2, got %+v", jb.Results[1])
 		}
 
 	}()
@@ -131,5 +221,770 @@ func TestMRJobFlowOK(t *testing.T) {
 			t.Fatal(err)
 		}
 	}
+	//Transitions should be reported as Kubernetes events on the master pod
+	events, err := cl.CoreV1().Events("default").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) == 0 {
+		t.Error("Expected Kubernetes events on the master pod")
+	}
 	//Check if secrets exist...
 }
+
+//Test lost workers are replaced and their tasks released, whether they fail or exit
+func TestWorkerReplaced(t *testing.T) {
+	for _, tc := range []struct {
+		phase  v1.PodPhase
+		reason string
+	}{
+		{v1.PodFailed, "Evicted"},
+		//kubemrworker exits 0 when the task it runs fails
+		{v1.PodSucceeded, ""},
+	} {
+		t.Run(string(tc.phase), func(t *testing.T) { testWorkerReplaced(t, tc.phase, tc.reason) })
+	}
+}
+
+func testWorkerReplaced(t *testing.T, phase v1.PodPhase, reason string) {
+	cl := fake.NewSimpleClientset()
+	jb := makejob(t)
+	err := jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pods, err := cl.CoreV1().Pods("default").List(metav1.ListOptions{LabelSelector: "job-name=foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 {
+		t.Fatalf("Expected 1 worker pod, got %v", len(pods.Items))
+	}
+	pod := pods.Items[0]
+	jb.Lock()
+	jb.Maps[0] = MapTask{Input: "a"}
+	jb.setStatus(StatusMap)
+	jb.Unlock()
+	//The worker acquires the task, workers report their hostname which is the pod name
+	rec := httptest.NewRecorder()
+	jb.router().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/foo/"+jb.RunID+"/map/0", strings.NewReader(`{"worker":"`+pod.Name+`","input":"a","status":"PROGRESS"}`)))
+	if rec.Code != 200 || jb.Maps[0].Worker != pod.Name || len(jb.Maps[0].Attempts) != 1 {
+		t.Fatalf("Expected %s to acquire the task, got %v %s, %+v", pod.Name, rec.Code, rec.Body, jb.Maps[0])
+	}
+	jb.watchWorkers()
+	defer jb.stopWatcher()
+	//The worker goes away
+	pod.Status.Phase = phase
+	pod.Status.Reason = reason
+	_, err = cl.CoreV1().Pods("default").UpdateStatus(&pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		jb.RLock()
+		task, restarts := jb.Maps[0], jb.Restarts
+		jb.RUnlock()
+		pods, err = cl.CoreV1().Pods("default").List(metav1.ListOptions{LabelSelector: "job-name=foo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.Worker == "" && restarts == 1 && len(pods.Items) == 2 {
+			if task.Status != "" || task.Started != nil {
+				t.Errorf("Expected released task, got %+v", task)
+			}
+			if len(task.Attempts) != 1 || task.Attempts[0].Worker != pod.Name || task.Attempts[0].Status != StatusFail || task.Attempts[0].Finished == nil {
+				t.Errorf("Expected the attempt of %s to be marked %s, got %+v", pod.Name, StatusFail, task.Attempts)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected task to be released and worker replaced, got %+v, %v restarts, %v pods", task, restarts, len(pods.Items))
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+//Test workers are added while tasks are pending and retired in the tail of reduce
+func TestScale(t *testing.T) {
+	cl := fake.NewSimpleClientset()
+	jb := makejob(t)
+	maxReplicas := int32(3)
+	jb.MaxReplicas = &maxReplicas
+	err := jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	countPods := func() int {
+		pods, err := cl.CoreV1().Pods("default").List(metav1.ListOptions{LabelSelector: "job-name=foo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(pods.Items)
+	}
+	for i, input := range jb.Inputs {
+		jb.Maps[i] = MapTask{Input: input}
+	}
+	jb.setStatus(StatusMap)
+	//A replacement being created takes a slot
+	jb.creating = 1
+	jb.scale()
+	if n := countPods(); n != 2 {
+		t.Fatalf("Expected 2 worker pods while a replacement is created, got %v", n)
+	}
+	jb.creating = 0
+	jb.scale()
+	//3 pending maps, capped by maxreplicas
+	if n := countPods(); n != 3 {
+		t.Fatalf("Expected 3 worker pods, got %v", n)
+	}
+	var busy string
+	for name := range jb.live {
+		busy = name
+		break
+	}
+	jb.Reduces[0] = ReduceTask{Worker: busy, Status: StatusProgress}
+	jb.Reduces[1] = ReduceTask{Worker: "foo", Status: StatusComplete}
+	jb.setStatus(StatusReduce)
+	jb.scale()
+	if len(jb.Retire) != 2 || len(jb.live) != 1 || !jb.live[busy] {
+		t.Errorf("Expected all but the busy worker %s retired, got %v", busy, jb.Retire)
+	}
+}
+
+//Test the map workers are replaced by the reduce fleet
+func TestSeparateFleets(t *testing.T) {
+	cl := fake.NewSimpleClientset()
+	jb := makejob(t)
+	mapreplicas, reducereplicas := int32(2), int32(1)
+	jb.MapReplicas, jb.ReduceReplicas = &mapreplicas, &reducereplicas
+	jb.ReduceTemplate = jb.Template.DeepCopy()
+	jb.ReduceTemplate.Spec.Containers[0].Image = "turbobytes/kubemr-bigreduce"
+	err := jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fleet := func(name string) []v1.Pod {
+		pods, err := cl.CoreV1().Pods("default").List(metav1.ListOptions{LabelSelector: "job-name=foo,kubemr-fleet=" + name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pods.Items
+	}
+	if n := len(fleet("map")); n != 2 {
+		t.Fatalf("Expected 2 map workers, got %v", n)
+	}
+	for i, input := range jb.Inputs {
+		jb.Maps[i] = MapTask{Input: input, Worker: "foo", Status: StatusComplete, Outputs: map[int]string{0: input}}
+	}
+	jb.setStatus(StatusMap)
+	_, err = jb.jobloop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jb.Status != StatusReduce {
+		t.Fatalf("Expected reduce stage, got %s", jb.Status)
+	}
+	if n := len(fleet("map")); n != 0 {
+		t.Errorf("Expected map workers to be gone, got %v", n)
+	}
+	reduce := fleet("reduce")
+	if len(reduce) != 1 || reduce[0].Spec.Containers[0].Image != "turbobytes/kubemr-bigreduce" {
+		t.Errorf("Expected 1 reduce worker from the reduce template, got %+v", reduce)
+	}
+}
+
+//Test workers can run in another namespace, reaching the master through a Service
+func TestWorkerNamespace(t *testing.T) {
+	cl := fake.NewSimpleClientset(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "master", Namespace: "default"}})
+	jb := makejob(t)
+	jb.MasterPod = "master"
+	jb.WorkerNamespace = "batch"
+	jb.AdvertiseURL = "http://kubemr-foo.default.svc:8989/"
+	cfg := testConfig(nil)
+	err := jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "http://kubemr-foo.default.svc:8989/foo/" + jb.RunID + "/"; cfg.JobURL != expected {
+		t.Errorf("Expected job url %s, got %s", expected, cfg.JobURL)
+	}
+	pods, err := cl.CoreV1().Pods("batch").List(metav1.ListOptions{LabelSelector: "job-name=foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 {
+		t.Fatalf("Expected 1 worker pod in batch, got %v", len(pods.Items))
+	}
+	//Owner references can not cross namespaces
+	if refs := pods.Items[0].OwnerReferences; len(refs) != 0 {
+		t.Errorf("Expected no owner references, got %v", refs)
+	}
+	err = jb.cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pods, err = cl.CoreV1().Pods("batch").List(metav1.ListOptions{LabelSelector: "job-name=foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("Expected worker pods to be deleted, got %v", len(pods.Items))
+	}
+}
+
+//Test aborting a job deletes workers nothing owns, as when the master runs outside the cluster
+func TestAbort(t *testing.T) {
+	cl := fake.NewSimpleClientset()
+	jb := makejob(t)
+	err := jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pods, err := cl.CoreV1().Pods("default").List(metav1.ListOptions{LabelSelector: "job-name=foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 || len(pods.Items[0].OwnerReferences) != 0 {
+		t.Fatalf("Expected 1 worker pod without owner, got %v", pods.Items)
+	}
+	jb.Abort("Received interrupt")
+	err = jb.Start(time.Minute)
+	if err == nil || err.Error() != "Received interrupt" {
+		t.Errorf("Expected the job to be aborted, got %v", err)
+	}
+	if jb.Status != StatusFail || jb.Err != "Received interrupt" {
+		t.Errorf("Expected status %s with the reason, got %s %s", StatusFail, jb.Status, jb.Err)
+	}
+	pods, err = cl.CoreV1().Pods("default").List(metav1.ListOptions{LabelSelector: "job-name=foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("Expected worker pods to be deleted, got %v", len(pods.Items))
+	}
+}
+
+//Test the master is exposed through a Service only workers can reach
+func TestMasterService(t *testing.T) {
+	cl := fake.NewSimpleClientset(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "master", Namespace: "default"}})
+	jb := makejob(t)
+	jb.MasterPod = "master"
+	jb.ServiceType = ServiceClusterIP
+	jb.NetworkPolicy = true
+	//Prometheus scrapes from its own namespace
+	jb.NetworkPolicyFrom = []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": "monitoring"}}}}
+	port := freeport.GetPort()
+	cfg := testConfig(nil)
+	err := jb.Init(cl, fmt.Sprintf(":%v", port), "127.0.0.1", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf("http://kubemr-foo-%s.default.svc:%v/foo/%s/", jb.RunID, port, jb.RunID); cfg.JobURL != expected {
+		t.Errorf("Expected job url %s, got %s", expected, cfg.JobURL)
+	}
+	master, err := cl.CoreV1().Pods("default").Get("master", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := cl.CoreV1().Services("default").Get("kubemr-foo-"+jb.RunID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range svc.Spec.Selector {
+		if master.Labels[k] != v {
+			t.Errorf("Service selector %s=%s does not match the master pod", k, v)
+		}
+	}
+	policy, err := cl.NetworkingV1().NetworkPolicies("default").Get("kubemr-foo-"+jb.RunID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from := policy.Spec.Ingress[0].From; len(from) != 2 || from[0].PodSelector == nil || from[1].NamespaceSelector == nil {
+		t.Errorf("Expected workers and the monitoring namespace to be let in, got %+v", from)
+	}
+	//Failing to delete the NetworkPolicy does not keep the workers around
+	failed := false
+	cl.PrependReactor("delete", "networkpolicies", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failed {
+			return false, nil, nil
+		}
+		failed = true
+		return true, nil, fmt.Errorf("forbidden")
+	})
+	err = jb.cleanup()
+	if err == nil {
+		t.Error("Expected cleanup to report the NetworkPolicy")
+	}
+	pods, err := cl.CoreV1().Pods("default").List(metav1.ListOptions{LabelSelector: jb.workerSelector()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("Expected worker pods to be deleted, got %v", len(pods.Items))
+	}
+	err = jb.cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.CoreV1().Services("default").Get("kubemr-foo-"+jb.RunID, metav1.GetOptions{})
+	if err == nil {
+		t.Error("Expected the Service to be deleted")
+	}
+	_, err = cl.NetworkingV1().NetworkPolicies("default").Get("kubemr-foo-"+jb.RunID, metav1.GetOptions{})
+	if err == nil {
+		t.Error("Expected the NetworkPolicy to be deleted")
+	}
+}
+
+//Test Init checks storage before touching the cluster, and deletes what it created when it fails later on
+func TestInitCleanup(t *testing.T) {
+	newjob := func() (*fake.Clientset, *MapReduceJob) {
+		cl := fake.NewSimpleClientset(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "master", Namespace: "default"}})
+		jb := makejob(t)
+		jb.MasterPod = "master"
+		jb.ServiceType = ServiceClusterIP
+		jb.NetworkPolicy = true
+		replicas := int32(2)
+		jb.Replicas = &replicas
+		return cl, jb
+	}
+	//An output holding results of another run is refused before anything is created
+	cl, jb := newjob()
+	jb.Output = "/out/"
+	err := jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(memStorage{"/out/part-0": []byte("x")}))
+	if err == nil || !strings.Contains(err.Error(), "is not empty") {
+		t.Fatalf("Expected Init to refuse the output, got %v", err)
+	}
+	master, err := cl.CoreV1().Pods("default").Get("master", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(master.Labels) != 0 {
+		t.Errorf("Expected the master pod not to be labelled, got %v", master.Labels)
+	}
+	services, err := cl.CoreV1().Services("default").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services.Items) != 0 {
+		t.Errorf("Expected no Service, got %v", len(services.Items))
+	}
+	//The second worker can not be created
+	cl, jb = newjob()
+	created := 0
+	cl.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		created++
+		if created == 2 {
+			return true, nil, fmt.Errorf("exceeded quota")
+		}
+		return false, nil, nil
+	})
+	err = jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(nil))
+	if err == nil || !strings.Contains(err.Error(), "exceeded quota") {
+		t.Fatalf("Expected Init to fail creating workers, got %v", err)
+	}
+	pods, err := cl.CoreV1().Pods("default").List(metav1.ListOptions{LabelSelector: "job-name=foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("Expected worker pods to be deleted, got %v", len(pods.Items))
+	}
+	services, err = cl.CoreV1().Services("default").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services.Items) != 0 {
+		t.Errorf("Expected the Service to be deleted, got %v", len(services.Items))
+	}
+	policies, err := cl.NetworkingV1().NetworkPolicies("default").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies.Items) != 0 {
+		t.Errorf("Expected the NetworkPolicy to be deleted, got %v", len(policies.Items))
+	}
+}
+
+//testConfig is a valid config using st, or empty storage if nil
+func testConfig(st storage.Storage) *Config {
+	if st == nil {
+		st = memStorage{}
+	}
+	return &Config{S3Region: "us-east-1", BucketName: "bucket", Storage: st}
+}
+
+//memStorage keeps objects in memory
+type memStorage map[string][]byte
+
+func (st memStorage) List(prefix string) ([]storage.Object, error) {
+	objects := make([]storage.Object, 0)
+	for key, data := range st {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, storage.Object{Key: key, Size: int64(len(data))})
+		}
+	}
+	return objects, nil
+}
+
+func (st memStorage) Delete(key string) error {
+	delete(st, key)
+	return nil
+}
+
+func (st memStorage) Get(key string) (io.ReadCloser, error) {
+	data, ok := st[key]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", key)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (st memStorage) Put(key string, data []byte) error {
+	st[key] = data
+	return nil
+}
+
+func (st memStorage) PutReader(key string, r io.Reader, size int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	st[key] = data
+	return nil
+}
+
+func (st memStorage) Copy(src, dst string) (storage.Object, error) {
+	data, ok := st[src]
+	if !ok {
+		return storage.Object{}, fmt.Errorf("%s not found", src)
+	}
+	st[dst] = data
+	return storage.Object{Key: dst, Size: int64(len(data)), Checksum: fmt.Sprintf("sha256:%x", sha256.Sum256(data))}, nil
+}
+
+//Test map outputs are deleted according to the cleanup policy
+func TestCleanupStorage(t *testing.T) {
+	st := memStorage{}
+	jb := makejob(t)
+	jb.RunID = "run"
+	for _, key := range []string{"/test/foo/run/_temporary/map-0-a/map/0-1.txt", "/test/foo/run/_temporary/map-1-a/map/1-1.txt", "/test/foo/run/output/part-00001.txt", "/test/foo/other/_temporary/map-0-a/map/0-1.txt"} {
+		st[key] = []byte("foo")
+	}
+	err := jb.Init(fake.NewSimpleClientset(), fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", &Config{S3Region: "us-east-1", BucketName: "bucket", BucketPrefix: "test", Storage: st})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jb.CleanupPolicy != CleanupOnSuccess {
+		t.Errorf("Expected default cleanup policy %s, got %s", CleanupOnSuccess, jb.CleanupPolicy)
+	}
+	//Failed jobs keep their intermediates
+	err = jb.cleanupStorage(fmt.Errorf("failed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st) != 4 {
+		t.Errorf("Expected intermediates of failed job to be kept, got %v", st)
+	}
+	err = jb.cleanupStorage(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st["/test/foo/run/output/part-00001.txt"]; len(st) != 2 || !ok {
+		t.Errorf("Expected only the result and the other run to be left, got %v", st)
+	}
+}
+
+//Test other runs of the same job are forbidden or replaced
+func TestConcurrencyPolicy(t *testing.T) {
+	now := time.Now()
+	pod := func(name string, created time.Time, labels map[string]string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", CreationTimestamp: metav1.NewTime(created), Labels: labels}}
+	}
+	objects := func() *fake.Clientset {
+		return fake.NewSimpleClientset(
+			pod("master", now, nil),
+			pod("oldmaster", now.Add(-time.Hour), map[string]string{jobLabel: "foo", masterLabel: "old"}),
+			pod("foo-old", now.Add(-time.Hour), map[string]string{"job-name": "foo", runLabel: "old"}),
+		)
+	}
+	//A run started at the same time, but a moment later
+	racing := func() *fake.Clientset {
+		return fake.NewSimpleClientset(
+			pod("master", now, nil),
+			pod("newmaster", now.Add(time.Second), map[string]string{jobLabel: "foo", masterLabel: "new"}),
+			pod("foo-new", now.Add(time.Second), map[string]string{"job-name": "foo", runLabel: "new"}),
+		)
+	}
+	cl := racing()
+	jb := makejob(t)
+	jb.MasterPod = "master"
+	jb.ConcurrencyPolicy = ConcurrencyForbid
+	err := jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(nil))
+	if err != nil {
+		t.Errorf("Expected the older run to win under Forbid, got %v", err)
+	}
+	cl = racing()
+	jb = makejob(t)
+	jb.MasterPod = "master"
+	jb.ConcurrencyPolicy = ConcurrencyReplace
+	err = jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(nil))
+	if err == nil {
+		t.Error("Expected Replace to give way to a newer run")
+	}
+	for _, name := range []string{"newmaster", "foo-new"} {
+		_, err = cl.CoreV1().Pods("default").Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("Expected %s of the newer run to be kept, got %v", name, err)
+		}
+	}
+	cl = objects()
+	jb = makejob(t)
+	jb.MasterPod = "master"
+	jb.ConcurrencyPolicy = ConcurrencyForbid
+	err = jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(nil))
+	if err == nil {
+		t.Error("Expected Forbid to fail while another run is going on")
+	}
+	cl = objects()
+	jb = makejob(t)
+	jb.MasterPod = "master"
+	jb.ConcurrencyPolicy = ConcurrencyReplace
+	err = jb.Init(cl, fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"oldmaster", "foo-old"} {
+		_, err = cl.CoreV1().Pods("default").Get(name, metav1.GetOptions{})
+		if err == nil {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+	pods, err := cl.CoreV1().Pods("default").List(metav1.ListOptions{LabelSelector: jb.workerSelector()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 {
+		t.Errorf("Expected 1 worker pod of the new run, got %v", len(pods.Items))
+	}
+}
+
+//Test only the winning attempts are published
+func TestCommit(t *testing.T) {
+	st := memStorage{}
+	jb := makejob(t)
+	jb.RunID = "run"
+	jb.Output = "results/foo"
+	err := jb.Init(fake.NewSimpleClientset(), fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", &Config{S3Region: "us-east-1", BucketName: "bucket", BucketPrefix: "test", Storage: st})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Attempt a of reduce 0 got lost, b completed it
+	st["/test/foo/run/_temporary/reduce-0-a/reduce/0.txt"] = []byte("lost")
+	st["/test/foo/run/_temporary/reduce-0-b/reduce/0.txt"] = []byte("won")
+	jb.Reduces[0] = ReduceTask{Status: StatusComplete, Output: "s3://bucket/test/foo/run/_temporary/reduce-0-b/reduce/0.txt", Counters: map[string]int64{CounterOutputRecords: 1}}
+	jb.Reduces[1] = ReduceTask{Status: StatusComplete, Output: "mysql://results/table"}
+	results, err := jb.commit(jb.Reduces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].URI != "s3://bucket/results/foo/part-00000.txt" || results[1].URI != "mysql://results/table" {
+		t.Fatalf("Unexpected results %+v", results)
+	}
+	if results[0].Partition != 0 || results[0].Size != 3 || results[0].Records != 1 || results[0].Checksum == "" {
+		t.Errorf("Unexpected result %+v", results[0])
+	}
+	if data := string(st["/results/foo/part-00000.txt"]); data != "won" {
+		t.Errorf("Expected the winning attempt to be published, got %q", data)
+	}
+	manifest := Manifest{}
+	err = json.Unmarshal(st["/results/foo/_SUCCESS"], &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.RunID != "run" || len(manifest.Results) != 2 {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+	//Results of another run are not mixed in
+	_, err = jb.commit(jb.Reduces)
+	if err == nil {
+		t.Error("Expected publishing to a non-empty output to fail")
+	}
+	//What was published before a failure is deleted
+	delete(st, "/results/foo/part-00000.txt")
+	delete(st, "/results/foo/_SUCCESS")
+	jb.Reduces[1] = ReduceTask{Status: StatusComplete, Output: "s3://bucket/test/foo/run/_temporary/reduce-1-a/reduce/1.txt"}
+	_, err = jb.commit(jb.Reduces)
+	if err == nil {
+		t.Error("Expected publishing a missing output to fail")
+	}
+	if _, ok := st["/results/foo/part-00000.txt"]; ok {
+		t.Error("Expected part-00000.txt to be deleted after the failure")
+	}
+	//Storage is not needed if nothing was written by attempts
+	jb.config.Storage = nil
+	jb.config.S3Endpoint = "http://127.0.0.1:1"
+	results, err = jb.commit(map[int]ReduceTask{0: {Status: StatusComplete, Output: "mysql://results/table"}})
+	if err != nil || len(results) != 1 {
+		t.Errorf("Expected results to be passed on, got %+v %v", results, err)
+	}
+	//Init checks the output
+	jb = makejob(t)
+	jb.Output = "results/foo"
+	st["/results/foo/part-00000.txt"] = []byte("old")
+	err = jb.Init(fake.NewSimpleClientset(), fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(st))
+	if err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Errorf("Expected Init to refuse a non-empty output, got %v", err)
+	}
+}
+
+//blockingStorage holds up copies until release is closed
+type blockingStorage struct {
+	memStorage
+	release chan bool
+}
+
+func (st blockingStorage) Copy(src, dst string) (storage.Object, error) {
+	<-st.release
+	return st.memStorage.Copy(src, dst)
+}
+
+//Test publishing does not hold the job lock
+func TestPublishUnlocked(t *testing.T) {
+	st := blockingStorage{memStorage: memStorage{}, release: make(chan bool)}
+	jb := makejob(t)
+	err := jb.Init(fake.NewSimpleClientset(), fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(st))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := jb.config.BucketPrefix + AttemptPrefix("reduce", 0, "w") + "reduce/0.txt"
+	st.memStorage[key] = []byte("foo")
+	jb.Reduces[0] = ReduceTask{Status: StatusComplete, Worker: "w", Output: jb.uri(key)}
+	jb.setStatus(StatusReduce)
+	done, err := jb.jobloop()
+	if done || err != nil {
+		t.Fatalf("Expected the job to go on while publishing, got %v %v", done, err)
+	}
+	locked := make(chan bool)
+	go func() {
+		jb.RLock()
+		jb.RUnlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the job lock to be free while publishing")
+	}
+	close(st.release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		jb.RLock()
+		status, results := jb.Status, jb.Results
+		jb.RUnlock()
+		if status == StatusComplete {
+			if len(results) != 1 {
+				t.Errorf("Expected 1 result, got %+v", results)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the job to complete once published, got %s", status)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+//Test results published once the job failed are retracted, and that completed jobs do not fail afterwards
+func TestPublishAfterFail(t *testing.T) {
+	st := blockingStorage{memStorage: memStorage{}, release: make(chan bool)}
+	jb := makejob(t)
+	err := jb.Init(fake.NewSimpleClientset(), fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(st))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := jb.config.BucketPrefix + AttemptPrefix("reduce", 0, "w") + "reduce/0.txt"
+	st.memStorage[key] = []byte("foo")
+	jb.Reduces[0] = ReduceTask{Status: StatusComplete, Worker: "w", Output: jb.uri(key)}
+	jb.setStatus(StatusReduce)
+	_, err = jb.jobloop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//The job times out while publishing
+	err = jb.fail("Job timed out after 1m0s", ErrTimeout)
+	if err != ErrTimeout {
+		t.Errorf("Expected %v, got %v", ErrTimeout, err)
+	}
+	close(st.release)
+	select {
+	case <-jb.published:
+	case <-time.After(time.Second):
+		t.Fatal("Expected publishing to be over")
+	}
+	objects, err := st.List(jb.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 || jb.Status != StatusFail || jb.Results != nil {
+		t.Errorf("Expected failed job without results, got %s %+v, %v objects in output", jb.Status, jb.Results, len(objects))
+	}
+	//Timing out once publishing completed the job keeps it complete
+	jb.setStatus(StatusComplete)
+	err = jb.fail("Job timed out after 1m0s", ErrTimeout)
+	if err != nil || jb.Status != StatusComplete {
+		t.Errorf("Expected the job to stay complete, got %s %v", jb.Status, err)
+	}
+}
+
+//Test all problems with a job are reported at once
+func TestValidate(t *testing.T) {
+	jb := makejob(t)
+	errs := jb.Validate()
+	if len(errs) != 0 {
+		t.Errorf("Expected valid job, got %v", errs)
+	}
+	jb.Name = "foo_bar"
+	jb.Inputs = nil
+	jb.Template.Spec.Containers[0].Image = ""
+	jb.CleanupPolicy = "Sometimes"
+	jb.NetworkPolicy = true
+	errs = jb.Validate()
+	fields := make(map[string]bool)
+	for _, err := range errs {
+		fields[err.Field] = true
+	}
+	for _, fld := range []string{"name", "inputs", "template.spec.containers[0].image", "cleanuppolicy", "servicetype"} {
+		if !fields[fld] {
+			t.Errorf("Expected an error for %s, got %v", fld, errs)
+		}
+	}
+	err := jb.Init(fake.NewSimpleClientset(), fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", &Config{})
+	if err == nil || !strings.Contains(err.Error(), "config.BucketName") {
+		t.Errorf("Expected Init to report the config too, got %v", err)
+	}
+	err = (&Config{S3Region: "us-east-1"}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "BucketName") {
+		t.Errorf("Expected the config to need a bucket, got %v", err)
+	}
+	err = testConfig(nil).Validate()
+	if err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+}
+
+func TestObjectURL(t *testing.T) {
+	for uri, expected := range map[string]string{
+		"s3://bucket/test/output/part-00000": "https://s3.amazonaws.com/bucket/test/output/part-00000",
+		"https://example.com/x":              "https://example.com/x",
+		"db://table":                         "",
+	} {
+		if got := objectURL("https://s3.amazonaws.com/", uri); got != expected {
+			t.Errorf("Expected %s to link to %q, got %q", uri, expected, got)
+		}
+	}
+	if got := objectURL("", "s3://bucket/x"); got != "" {
+		t.Errorf("Expected no link without an endpoint, got %q", got)
+	}
+}
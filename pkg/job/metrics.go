@@ -0,0 +1,119 @@
+package job
+
+import "github.com/prometheus/client_golang/prometheus"
+
+//jobMetrics holds the prometheus metrics of a single job
+//Each job has its own registry so multiple jobs can live in one process
+type jobMetrics struct {
+	registry  *prometheus.Registry
+	duration  *prometheus.HistogramVec
+	failures  *prometheus.CounterVec
+	conflicts *prometheus.CounterVec
+	bytes     *prometheus.CounterVec
+	restarts  prometheus.Counter
+	workers   map[string]bool //Workers seen so far
+}
+
+func newJobMetrics(jb *MapReduceJob) *jobMetrics {
+	labels := prometheus.Labels{"kubemr_job": jb.Name}
+	m := &jobMetrics{
+		registry: prometheus.NewRegistry(),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "kubemr_task_duration_seconds",
+			Help:        "Time from acquisition to completion of tasks",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(1, 2, 14), //1s to ~2h
+		}, []string{"phase", "status"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "kubemr_task_failures_total",
+			Help:        "Number of tasks reported as failed",
+			ConstLabels: labels,
+		}, []string{"phase"}),
+		conflicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "kubemr_task_conflicts_total",
+			Help:        "Number of rejected attempts to acquire a task owned by another worker",
+			ConstLabels: labels,
+		}, []string{"phase"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			//Not kubemr_worker_bytes_total, workers export that themselves
+			Name:        "kubemr_job_reported_bytes_total",
+			Help:        "Bytes read and written by workers as reported to the master for finished tasks",
+			ConstLabels: labels,
+		}, []string{"phase", "direction"}),
+		restarts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "kubemr_worker_restarts_total",
+			Help:        "Number of worker pods created to replace lost ones",
+			ConstLabels: labels,
+		}),
+		workers: make(map[string]bool),
+	}
+	m.registry.MustRegister(m.duration, m.failures, m.conflicts, m.bytes, m.restarts)
+	m.registry.MustRegister(&jobCollector{
+		jb:      jb,
+		tasks:   prometheus.NewDesc("kubemr_tasks", "Number of tasks by phase and status", []string{"phase", "status"}, labels),
+		workers: prometheus.NewDesc("kubemr_workers", "Number of distinct workers that have acquired a task", nil, labels),
+		pods:    prometheus.NewDesc("kubemr_worker_pods", "Number of worker pods neither lost nor retired", nil, labels),
+	})
+	return m
+}
+
+//observe records a task update accepted by the master. Caller must hold the job lock
+func (m *jobMetrics) observe(phase, worker, status string, attempt *Attempt, read, written int64) {
+	m.workers[worker] = true
+	switch status {
+	case StatusProgress:
+		return
+	case StatusFail:
+		m.failures.WithLabelValues(phase).Inc()
+	}
+	if attempt != nil {
+		m.duration.WithLabelValues(phase, status).Observe(attempt.Seconds)
+	}
+	m.bytes.WithLabelValues(phase, "read").Add(float64(read))
+	m.bytes.WithLabelValues(phase, "written").Add(float64(written))
+}
+
+//jobCollector exposes the task table as gauges at scrape time
+type jobCollector struct {
+	jb      *MapReduceJob
+	tasks   *prometheus.Desc
+	workers *prometheus.Desc
+	pods    *prometheus.Desc
+}
+
+func (c *jobCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.tasks
+	ch <- c.workers
+	ch <- c.pods
+}
+
+func (c *jobCollector) Collect(ch chan<- prometheus.Metric) {
+	c.jb.RLock()
+	defer c.jb.RUnlock()
+	counts := make(map[string]map[string]int)
+	for _, phase := range []string{"map", "reduce"} {
+		//Always report the common statuses, so they drop to zero instead of vanishing
+		counts[phase] = map[string]int{StatusPending: 0, StatusProgress: 0, StatusComplete: 0, StatusFail: 0}
+	}
+	for _, m := range c.jb.Maps {
+		counts["map"][taskStatus(m.Status)]++
+	}
+	for _, r := range c.jb.Reduces {
+		counts["reduce"][taskStatus(r.Status)]++
+	}
+	for phase, statuses := range counts {
+		for status, n := range statuses {
+			ch <- prometheus.MustNewConstMetric(c.tasks, prometheus.GaugeValue, float64(n), phase, status)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.workers, prometheus.GaugeValue, float64(len(c.jb.metrics.workers)))
+	ch <- prometheus.MustNewConstMetric(c.pods, prometheus.GaugeValue, float64(len(c.jb.live)))
+}
+
+//taskStatus names the status of tasks nobody has picked up yet
+func taskStatus(status string) string {
+	if status == "" {
+		return StatusPending
+	}
+	return status
+}
@@ -29,5 +29,10 @@ func stampCommonEnv(cfg *Config) []v1.EnvVar {
 			Name:  "KUBEMR_S3_BUCKET_PREFIX",
 			Value: cfg.BucketPrefix,
 		},
+		//Collector for traces, blank disables tracing
+		v1.EnvVar{
+			Name:  "KUBEMR_OTLP_ENDPOINT",
+			Value: cfg.OTLPEndpoint,
+		},
 	}
 }
@@ -0,0 +1,145 @@
+package job
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+//Delete whatever belongs to a pod in the background
+var propagationBackground = metav1.DeletePropagationBackground
+
+//workerPods returns the client for worker pods
+func (jb *MapReduceJob) workerPods() corev1.PodInterface {
+	return jb.workercl.CoreV1().Pods(jb.WorkerNamespace)
+}
+
+//ownerReferences makes the master pod the owner of worker pods, so Kubernetes garbage collects them with the master
+//BlockOwnerDeletion is left unset, it would need update on pods/finalizers wherever OwnerReferencesPermissionEnforcement is on
+func (jb *MapReduceJob) ownerReferences() []metav1.OwnerReference {
+	//Owners must live in the same namespace of the same cluster
+	if jb.master == nil || jb.WorkerKubeconfig != "" || jb.WorkerNamespace != jb.Namespace {
+		return nil
+	}
+	return []metav1.OwnerReference{{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       jb.master.Name,
+		UID:        jb.master.UID,
+	}}
+}
+
+//Workers of a job without phase specific settings belong to this fleet
+const fleetAll = "all"
+
+//fleet names the workers running tasks of status
+func (jb *MapReduceJob) fleet(status string) string {
+	if jb.MapTemplate == nil && jb.ReduceTemplate == nil && jb.MapReplicas == nil && jb.ReduceReplicas == nil {
+		return fleetAll
+	}
+	if status == StatusReduce {
+		return "reduce"
+	}
+	return "map"
+}
+
+//template returns the pod template of fleet
+func (jb *MapReduceJob) template(fleet string) *v1.PodTemplateSpec {
+	switch {
+	case fleet == "map" && jb.MapTemplate != nil:
+		return jb.MapTemplate
+	case fleet == "reduce" && jb.ReduceTemplate != nil:
+		return jb.ReduceTemplate
+	}
+	return &jb.Template
+}
+
+//replicas returns the number of workers fleet starts with
+func (jb *MapReduceJob) replicas(fleet string) int32 {
+	switch {
+	case fleet == "map" && jb.MapReplicas != nil:
+		return *jb.MapReplicas
+	case fleet == "reduce" && jb.ReduceReplicas != nil:
+		return *jb.ReduceReplicas
+	}
+	return *jb.Replicas
+}
+
+//workerPod builds a worker pod of fleet from its template
+func (jb *MapReduceJob) workerPod(fleet string) *v1.Pod {
+	podspec := jb.template(fleet).DeepCopy()
+	//Hmm... instead of spamming k8 with secrets we let user handle KUBEMR_S3_ACCESS_KEY_ID and KUBEMR_S3_SECRET_ACCESS_KEY
+	for i := range podspec.Spec.Containers {
+		podspec.Spec.Containers[i].Env = append(podspec.Spec.Containers[i].Env, stampCommonEnv(jb.config)...)
+	}
+	labels := make(map[string]string)
+	for k, v := range podspec.Labels {
+		labels[k] = v
+	}
+	for k, v := range jb.workerLabels() {
+		labels[k] = v
+	}
+	labels["kubemr-fleet"] = fleet
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			//Same as GenerateName would do, but we know the name up front
+			Name:            fmt.Sprintf("%s-%s", jb.jobname, utilrand.String(5)),
+			Namespace:       jb.WorkerNamespace,
+			Labels:          labels,
+			Annotations:     podspec.Annotations,
+			OwnerReferences: jb.ownerReferences(),
+		},
+		Spec: podspec.Spec,
+	}
+	pod.Spec.RestartPolicy = v1.RestartPolicyNever
+	return pod
+}
+
+//createWorker creates a single worker pod of fleet
+func (jb *MapReduceJob) createWorker(fleet string) (*v1.Pod, error) {
+	p, err := jb.workerPods().Create(jb.workerPod(fleet))
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Created %s worker: %s", fleet, p.Name)
+	jb.record(Event{Type: EventPodCreated, Pod: p.Name, Message: fmt.Sprintf("Created %s worker pod %s", fleet, p.Name)})
+	return p, nil
+}
+
+//deleteWorker deletes a single worker pod
+func (jb *MapReduceJob) deleteWorker(name string) error {
+	err := jb.workerPods().Delete(name, &metav1.DeleteOptions{PropagationPolicy: &propagationBackground})
+	if err != nil {
+		return err
+	}
+	jb.record(Event{Type: EventPodDeleted, Pod: name, Message: "Deleted worker pod " + name})
+	return nil
+}
+
+//switchFleet replaces the map workers with the reduce fleet, if they differ. Caller must hold the job lock
+func (jb *MapReduceJob) switchFleet() error {
+	if jb.fleet(StatusMap) == jb.fleet(StatusReduce) {
+		return nil
+	}
+	//All maps are done, so the map workers are idle. Retire them so they do not pick reduce tasks while terminating
+	for name := range jb.live {
+		jb.Retire = append(jb.Retire, name)
+		delete(jb.live, name)
+		err := jb.deleteWorker(name)
+		if err != nil {
+			return err
+		}
+	}
+	for i := int32(0); i < jb.replicas("reduce"); i++ {
+		p, err := jb.createWorker("reduce")
+		if err != nil {
+			return err
+		}
+		jb.live[p.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package job
+
+import (
+	"time"
+)
+
+//Progress is reported by workers while a task is running
+type Progress struct {
+	Fraction float64   `json:"fraction"` //Between 0 and 1
+	Bytes    int64     `json:"bytes"`    //Bytes processed so far
+	Message  string    `json:"message"`  //Free form status message
+	Updated  time.Time `json:"updated"`  //Stamped by the master
+}
+
+//Estimate predicts when the current phase finishes
+//During the reduce phase this is the completion time of the job
+type Estimate struct {
+	Phase    string    `json:"phase"`
+	Fraction float64   `json:"fraction"` //How much of the phase is done
+	ETA      time.Time `json:"eta"`
+}
+
+//taskFraction returns how much of a task is done
+func taskFraction(status string, progress *Progress) float64 {
+	switch status {
+	case StatusComplete:
+		return 1
+	case StatusProgress:
+		if progress != nil && progress.Fraction > 0 && progress.Fraction < 1 {
+			return progress.Fraction
+		}
+	}
+	return 0
+}
+
+//estimate extrapolates the time spent so far in the current phase. Caller must hold the job lock
+func (jb *MapReduceJob) estimate() *Estimate {
+	var phase string
+	var done float64
+	var n int
+	switch jb.Status {
+	case StatusMap:
+		phase, n = "map", len(jb.Maps)
+		for _, m := range jb.Maps {
+			done += taskFraction(m.Status, m.Progress)
+		}
+	case StatusReduce:
+		phase, n = "reduce", len(jb.Reduces)
+		for _, r := range jb.Reduces {
+			done += taskFraction(r.Status, r.Progress)
+		}
+	default:
+		return nil
+	}
+	if n == 0 || done == 0 || jb.phaseStarted.IsZero() {
+		return nil
+	}
+	fraction := done / float64(n)
+	elapsed := time.Since(jb.phaseStarted)
+	return &Estimate{
+		Phase:    phase,
+		Fraction: fraction,
+		ETA:      jb.phaseStarted.Add(time.Duration(float64(elapsed) / fraction)),
+	}
+}
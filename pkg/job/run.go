@@ -0,0 +1,141 @@
+package job
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	//ConcurrencyAllow lets runs of the same job name run side by side
+	ConcurrencyAllow = "Allow"
+	//ConcurrencyForbid fails the job if another run of the same name is going on
+	ConcurrencyForbid = "Forbid"
+	//ConcurrencyReplace stops the other runs of the same name
+	ConcurrencyReplace = "Replace"
+)
+
+const (
+	//jobLabel holds the job name on the master pod. Worker pods use job-name
+	jobLabel = "kubemr-job"
+	//masterLabel holds the run ID on the master pod
+	masterLabel = "kubemr-master"
+	//runLabel holds the run ID on worker pods
+	runLabel = "kubemr-run"
+)
+
+//workerLabels identify the worker pods of this run
+func (jb *MapReduceJob) workerLabels() map[string]string {
+	return map[string]string{"job-name": jb.jobname, runLabel: jb.RunID}
+}
+
+//workerSelector selects the worker pods of this run
+func (jb *MapReduceJob) workerSelector() string {
+	return labels.SelectorFromSet(jb.workerLabels()).String()
+}
+
+//labelMaster labels the master pod with the job name and run ID
+func (jb *MapReduceJob) labelMaster() error {
+	master := jb.master.DeepCopy()
+	if master.Labels == nil {
+		master.Labels = make(map[string]string)
+	}
+	master.Labels[jobLabel] = jb.jobname
+	master.Labels[masterLabel] = jb.RunID
+	var err error
+	jb.master, err = jb.cl.CoreV1().Pods(jb.Namespace).Update(master)
+	return err
+}
+
+//active drops the pods that are over or going away
+func active(pods []v1.Pod) []v1.Pod {
+	running := make([]v1.Pod, 0)
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+			running = append(running, pod)
+		}
+	}
+	return running
+}
+
+//otherRuns returns the master and worker pods of other runs of the job still going on
+func (jb *MapReduceJob) otherRuns() (masters, workers []v1.Pod, err error) {
+	list, err := jb.cl.CoreV1().Pods(jb.Namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s,%s!=%s", jobLabel, jb.jobname, masterLabel, jb.RunID),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	masters = active(list.Items)
+	list, err = jb.workerPods().List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s,%s!=%s", jb.jobname, runLabel, jb.RunID),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	workers = active(list.Items)
+	return masters, workers, nil
+}
+
+//olderThan orders master pods by creation, then name, so runs starting together agree on which one is older
+func olderThan(a, b *v1.Pod) bool {
+	if !a.CreationTimestamp.Time.Equal(b.CreationTimestamp.Time) {
+		return a.CreationTimestamp.Time.Before(b.CreationTimestamp.Time)
+	}
+	return a.Name < b.Name
+}
+
+//checkConcurrency applies ConcurrencyPolicy to other runs of the job
+//Runs starting together see each other, so the oldest master wins: Forbid only fails for older runs, and Replace
+//only deletes older runs, failing if a newer one is there to replace us. Without masterpod we count as the newest
+func (jb *MapReduceJob) checkConcurrency() error {
+	if jb.ConcurrencyPolicy == ConcurrencyAllow {
+		return nil
+	}
+	masters, workers, err := jb.otherRuns()
+	if err != nil {
+		return err
+	}
+	older := make([]v1.Pod, 0)
+	newer := make(map[string]bool) //Run IDs
+	for i := range masters {
+		if jb.master != nil && olderThan(jb.master, &masters[i]) {
+			newer[masters[i].Labels[masterLabel]] = true
+		} else {
+			older = append(older, masters[i])
+		}
+	}
+	//Workers of newer runs are theirs to deal with, the rest belong to older runs or runs whose master is gone
+	stale := make([]v1.Pod, 0)
+	for _, pod := range workers {
+		if !newer[pod.Labels[runLabel]] {
+			stale = append(stale, pod)
+		}
+	}
+	if jb.ConcurrencyPolicy == ConcurrencyForbid {
+		if len(older)+len(stale) > 0 {
+			return fmt.Errorf("Job %s is already running", jb.Name)
+		}
+		return nil
+	}
+	if len(newer) > 0 {
+		return fmt.Errorf("Job %s is being replaced by a newer run", jb.Name)
+	}
+	for _, pod := range older {
+		log.Infof("Replacing run %s of %s, deleting master %s", pod.Labels[masterLabel], jb.Name, pod.Name)
+		err = jb.cl.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{PropagationPolicy: &propagationBackground})
+		if err != nil {
+			return err
+		}
+	}
+	for _, pod := range stale {
+		err = jb.deleteWorker(pod.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package job
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//scale adds worker pods while tasks are pending, and retires idle workers during the tail of the reduce phase
+//Caller must hold the job lock
+func (jb *MapReduceJob) scale() {
+	busy := make(map[string]bool)
+	pending := 0
+	count := func(worker, status string) {
+		switch status {
+		case "":
+			pending++
+		case StatusProgress:
+			busy[worker] = true
+		}
+	}
+	switch jb.Status {
+	case StatusMap:
+		for _, m := range jb.Maps {
+			count(m.Worker, m.Status)
+		}
+	case StatusReduce:
+		for _, r := range jb.Reduces {
+			count(r.Worker, r.Status)
+		}
+	default:
+		return
+	}
+	desired := int32(pending + len(busy))
+	if desired < *jb.MinReplicas {
+		desired = *jb.MinReplicas
+	}
+	if desired > *jb.MaxReplicas {
+		desired = *jb.MaxReplicas
+	}
+	live := int32(len(jb.live) + jb.creating)
+	for ; live < desired; live++ {
+		p, err := jb.createWorker(jb.fleet(jb.Status))
+		if err != nil {
+			log.Errorf("Unable to add worker pod: %s", err)
+			return
+		}
+		jb.live[p.Name] = true
+	}
+	//Workers freed at the end of the map phase are needed for reduce, so only shrink in the reduce phase
+	if jb.Status != StatusReduce {
+		return
+	}
+	for name := range jb.live {
+		if live <= desired {
+			break
+		}
+		if busy[name] {
+			continue
+		}
+		//Idle workers exit once they see themselves in Retire
+		jb.Retire = append(jb.Retire, name)
+		delete(jb.live, name)
+		live--
+		jb.record(Event{Type: EventPodRetired, Pod: name, Message: fmt.Sprintf("Worker pod %s retired, %v workers left", name, live)})
+	}
+}
+
+//retired tells if worker was told to exit. Caller must hold the job lock
+func (jb *MapReduceJob) retired(worker string) bool {
+	for _, name := range jb.Retire {
+		if name == worker {
+			return true
+		}
+	}
+	return false
+}
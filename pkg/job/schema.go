@@ -0,0 +1,138 @@
+package job
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	timeType      = reflect.TypeOf(time.Time{})
+	metaTimeType  = reflect.TypeOf(metav1.Time{})
+)
+
+//statusFields are filled in by the master as the job runs, they are not part of a spec
+var statusFields = map[string]bool{
+	"status":   true,
+	"error":    true,
+	"maps":     true,
+	"reduces":  true,
+	"results":  true,
+	"counters": true,
+	"estimate": true,
+	"summary":  true,
+	"retire":   true,
+	"restarts": true,
+}
+
+//Schema returns a JSON Schema of job specs, for editors to validate spec files against
+//It is generated from the json tags of MapReduceJob, so it does not know what fields are required beyond name and inputs
+func Schema() ([]byte, error) {
+	definitions := make(map[string]interface{})
+	//The job itself goes at the top, not in definitions
+	properties := make(map[string]interface{})
+	addFields(reflect.TypeOf(MapReduceJob{}), properties, definitions, statusFields)
+	root := map[string]interface{}{"type": "object", "properties": properties}
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["title"] = "MapReduceJob"
+	root["required"] = []string{"name", "inputs"}
+	root["definitions"] = definitions
+	return json.MarshalIndent(root, "", "  ")
+}
+
+//definitionName names the definition of a named type, the same with or without vendoring
+func definitionName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/vendor/"); i >= 0 {
+		pkg = pkg[i+len("/vendor/"):]
+	}
+	return strings.Replace(pkg, "/", ".", -1) + "." + t.Name()
+}
+
+//schemaOf returns the schema of t, adding the named structs it uses to definitions
+func schemaOf(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType || t == metaTimeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		//Custom encoding, e.g. resource.Quantity or intstr.IntOrString. Anything goes
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			//base64
+			return map[string]interface{}{"type": "string"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), definitions)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), definitions)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, definitions)
+		}
+		name := definitionName(t)
+		if _, ok := definitions[name]; !ok {
+			//Placeholder first, types can refer to themselves
+			definitions[name] = map[string]interface{}{}
+			definitions[name] = structSchema(t, definitions)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + name}
+	}
+	//Interfaces, channels, funcs...
+	return map[string]interface{}{}
+}
+
+//structSchema returns the schema of a struct, with the fields of embedded structs inlined
+func structSchema(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	addFields(t, properties, definitions, nil)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+//addFields adds the fields of t to properties, leaving out the ones named in skip
+func addFields(t reflect.Type, properties, definitions map[string]interface{}, skip map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			addFields(ft, properties, definitions, skip)
+			continue
+		}
+		if f.PkgPath != "" {
+			//Unexported
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if skip[name] {
+			continue
+		}
+		properties[name] = schemaOf(f.Type, definitions)
+	}
+}
@@ -0,0 +1,116 @@
+package job
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	//ServiceClusterIP exposes the master through a Service with a virtual IP
+	ServiceClusterIP = "ClusterIP"
+	//ServiceHeadless exposes the master through a Service resolving straight to the master pod
+	ServiceHeadless = "Headless"
+)
+
+//exposeMaster creates a Service in front of the master, and optionally a NetworkPolicy letting only workers and NetworkPolicyFrom in
+//Returns the host:port workers should use
+func (jb *MapReduceJob) exposeMaster(addr string) (string, error) {
+	if jb.master == nil {
+		return "", fmt.Errorf("masterpod is required to create a Service")
+	}
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", err
+	}
+	//Init labelled the master pod with the run
+	selector := map[string]string{masterLabel: jb.RunID}
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "kubemr-" + jb.jobname + "-" + jb.RunID,
+			Namespace:       jb.Namespace,
+			OwnerReferences: jb.ownerReferences(),
+		},
+		Spec: v1.ServiceSpec{
+			Selector: selector,
+			Ports:    []v1.ServicePort{{Name: "http", Port: int32(port), TargetPort: intstr.FromInt(port)}},
+		},
+	}
+	if jb.ServiceType == ServiceHeadless {
+		svc.Spec.ClusterIP = v1.ClusterIPNone
+	}
+	svc, err = jb.cl.CoreV1().Services(jb.Namespace).Create(svc)
+	if err != nil {
+		return "", err
+	}
+	jb.service = svc.Name
+	log.Infof("Created service: %s", svc.Name)
+	if jb.NetworkPolicy {
+		err = jb.createNetworkPolicy(selector, port)
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s.%s.svc:%v", svc.Name, svc.Namespace, port), nil
+}
+
+//createNetworkPolicy only lets worker pods, and NetworkPolicyFrom, talk to the master
+func (jb *MapReduceJob) createNetworkPolicy(selector map[string]string, port int) error {
+	tcp := v1.ProtocolTCP
+	target := intstr.FromInt(port)
+	policy, err := jb.cl.NetworkingV1().NetworkPolicies(jb.Namespace).Create(&networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "kubemr-" + jb.jobname + "-" + jb.RunID,
+			Namespace:       jb.Namespace,
+			OwnerReferences: jb.ownerReferences(),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: selector},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &target}},
+				From: append([]networkingv1.NetworkPolicyPeer{{
+					PodSelector: &metav1.LabelSelector{MatchLabels: jb.workerLabels()},
+				}}, jb.NetworkPolicyFrom...),
+			}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	jb.policy = policy.Name
+	log.Infof("Created network policy: %s", policy.Name)
+	return nil
+}
+
+//unexposeMaster deletes the Service and NetworkPolicy, if any
+func (jb *MapReduceJob) unexposeMaster() error {
+	errs := make([]error, 0)
+	if jb.policy != "" {
+		err := jb.cl.NetworkingV1().NetworkPolicies(jb.Namespace).Delete(jb.policy, &metav1.DeleteOptions{})
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			jb.policy = ""
+		}
+	}
+	if jb.service != "" {
+		err := jb.cl.CoreV1().Services(jb.Namespace).Delete(jb.service, &metav1.DeleteOptions{})
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			jb.service = ""
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
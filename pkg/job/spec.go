@@ -0,0 +1,188 @@
+package job
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/turbobytes/kubemr/pkg/storage"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+//SpecConfigMapKey is the key of the job spec in ConfigMaps holding more than one entry
+const SpecConfigMapKey = "job.yaml"
+
+//inputRange matches numeric ranges like {1..10} or {001..100} in inputs
+var inputRange = regexp.MustCompile(`\{(\d+)\.\.(\d+)\}`)
+
+//maxRangeInputs is the most inputs the ranges of one input may expand to, each of them is a map task
+const maxRangeInputs = 100000
+
+//ParseSpec decodes a job spec, YAML or JSON
+func ParseSpec(b []byte) (*MapReduceJob, error) {
+	jb := &MapReduceJob{}
+	//JSON is YAML too
+	err := yaml.Unmarshal(b, jb)
+	if err != nil {
+		return nil, err
+	}
+	return jb, nil
+}
+
+//ReadSpec decodes a job spec from r
+func ReadSpec(r io.Reader) (*MapReduceJob, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpec(b)
+}
+
+//ReadSpecFile decodes the job spec in filename, - reads stdin
+func ReadSpecFile(filename string) (*MapReduceJob, error) {
+	if filename == "-" {
+		return ReadSpec(os.Stdin)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSpec(f)
+}
+
+//ReadSpecConfigMap decodes the job spec at key of a ConfigMap
+//If key is empty, the only entry or the one at SpecConfigMapKey is used
+func ReadSpecConfigMap(cl kubernetes.Interface, namespace, name, key string) (*MapReduceJob, error) {
+	cm, err := cl.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		key = SpecConfigMapKey
+		if len(cm.Data) == 1 {
+			for k := range cm.Data {
+				key = k
+			}
+		}
+	}
+	spec, ok := cm.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("ConfigMap %s/%s has no %s", namespace, name, key)
+	}
+	return ParseSpec([]byte(spec))
+}
+
+//ExpandInputs replaces templated inputs with what they stand for. Init calls it with Config.OpenBucket
+//
+//Numeric ranges like rfc{4501..4510}.txt expand to one input per number, keeping leading zeros of the start.
+//s3://bucket/prefix/*.gz style globs expand to the matching objects, opened with open. As with path.Match, * does not match /.
+func (jb *MapReduceJob) ExpandInputs(open func(bucket string) (storage.Storage, error)) error {
+	inputs := make([]string, 0, len(jb.Inputs))
+	for _, input := range jb.Inputs {
+		expanded, err := expandRanges(input)
+		if err != nil {
+			return err
+		}
+		for _, in := range expanded {
+			if !strings.HasPrefix(in, "s3://") || !strings.ContainsAny(in, "*?[") {
+				inputs = append(inputs, in)
+				continue
+			}
+			matches, err := glob(in, open)
+			if err != nil {
+				return err
+			}
+			inputs = append(inputs, matches...)
+		}
+	}
+	jb.Inputs = inputs
+	return nil
+}
+
+//expandRanges expands the numeric ranges in input
+func expandRanges(input string) ([]string, error) {
+	loc := inputRange.FindStringSubmatchIndex(input)
+	if loc == nil {
+		return []string{input}, nil
+	}
+	first, last := input[loc[2]:loc[3]], input[loc[4]:loc[5]]
+	start, err := strconv.Atoi(first)
+	if err != nil {
+		return nil, err
+	}
+	end, err := strconv.Atoi(last)
+	if err != nil {
+		return nil, err
+	}
+	if end < start {
+		return nil, fmt.Errorf("Range %s in %s goes backwards", input[loc[0]:loc[1]], input)
+	}
+	width := 0
+	if len(first) > 1 && first[0] == '0' {
+		width = len(first)
+	}
+	if end-start >= maxRangeInputs {
+		return nil, fmt.Errorf("Range %s in %s expands to more than %d inputs", input[loc[0]:loc[1]], input, maxRangeInputs)
+	}
+	//Expand the rest of the ranges too
+	rest, err := expandRanges(input[loc[1]:])
+	if err != nil {
+		return nil, err
+	}
+	if (end-start+1)*len(rest) > maxRangeInputs {
+		return nil, fmt.Errorf("Ranges in %s expand to more than %d inputs", input, maxRangeInputs)
+	}
+	inputs := make([]string, 0, (end-start+1)*len(rest))
+	for i := start; i <= end; i++ {
+		for _, r := range rest {
+			inputs = append(inputs, fmt.Sprintf("%s%0*d%s", input[:loc[0]], width, i, r))
+		}
+	}
+	return inputs, nil
+}
+
+//glob lists the objects matching an s3:// glob
+func glob(input string, open func(bucket string) (storage.Storage, error)) ([]string, error) {
+	if open == nil {
+		return nil, fmt.Errorf("No storage to expand %s with", input)
+	}
+	bucket, pattern := splitS3(input)
+	if pattern == "" {
+		return nil, fmt.Errorf("Input %s has no key", input)
+	}
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return nil, fmt.Errorf("Input %s: %s", input, err)
+	}
+	st, err := open(bucket)
+	if err != nil {
+		return nil, err
+	}
+	//List as little as possible
+	prefix := pattern[:strings.IndexAny(pattern, "*?[")]
+	objects, err := st.List("/" + prefix)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]string, 0)
+	for _, object := range objects {
+		key := strings.TrimPrefix(object.Key, "/")
+		if ok, _ := path.Match(pattern, key); ok {
+			matches = append(matches, "s3://"+bucket+"/"+key)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("Input %s matches nothing", input)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
@@ -0,0 +1,140 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/phayes/freeport"
+	"github.com/turbobytes/kubemr/pkg/storage"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const yamlSpec = `
+name: foo
+replicas: 2
+inputs:
+- https://tools.ietf.org/rfc/rfc{4501..4503}.txt
+- s3://logs/2017/day-0{8..9}/*.gz
+template:
+  spec:
+    containers:
+    - name: worker
+      image: turbobytes/kubemr-wordcount
+`
+
+func TestReadSpec(t *testing.T) {
+	cl := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Data:       map[string]string{"foo.yaml": yamlSpec},
+	})
+	jb, err := ReadSpecConfigMap(cl, "default", "foo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jb.Name != "foo" || *jb.Replicas != 2 || jb.Template.Spec.Containers[0].Image != "turbobytes/kubemr-wordcount" {
+		t.Errorf("Unexpected job %+v", jb)
+	}
+	//JSON works too
+	jb, err = ParseSpec([]byte(`{"name": "foo", "inputs": ["a"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jb.Name != "foo" || len(jb.Inputs) != 1 {
+		t.Errorf("Unexpected job %+v", jb)
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	jb, err := ParseSpec([]byte(yamlSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := memStorage{}
+	for _, key := range []string{"/2017/day-08/a.gz", "/2017/day-08/b.gz", "/2017/day-08/c.txt", "/2017/day-09/a.gz", "/2017/day-10/a.gz"} {
+		st[key] = []byte("foo")
+	}
+	err = jb.ExpandInputs(func(bucket string) (storage.Storage, error) {
+		if bucket != "logs" {
+			t.Errorf("Expected bucket logs, got %s", bucket)
+		}
+		return st, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"https://tools.ietf.org/rfc/rfc4501.txt",
+		"https://tools.ietf.org/rfc/rfc4502.txt",
+		"https://tools.ietf.org/rfc/rfc4503.txt",
+		"s3://logs/2017/day-08/a.gz",
+		"s3://logs/2017/day-08/b.gz",
+		"s3://logs/2017/day-09/a.gz",
+	}
+	if !reflect.DeepEqual(jb.Inputs, expected) {
+		t.Errorf("Expected %v, got %v", expected, jb.Inputs)
+	}
+	//Globs matching nothing are most likely a mistake
+	jb.Inputs = []string{"s3://logs/2018/*.gz"}
+	err = jb.ExpandInputs(func(bucket string) (storage.Storage, error) { return st, nil })
+	if err == nil {
+		t.Error("Expected error for glob matching nothing")
+	}
+	//Ranges are capped, alone or multiplied together
+	for _, input := range []string{"part-{0..999999999}", "part-{0..999}-{0..999}"} {
+		jb.Inputs = []string{input}
+		err = jb.ExpandInputs(nil)
+		if err == nil || !strings.Contains(err.Error(), "more than") {
+			t.Errorf("Expected %s to be refused, got %v", input, err)
+		}
+	}
+	//Init expands the inputs, globs in the bucket of the config are listed with its storage
+	jb = makejob(t)
+	jb.Inputs = []string{"part-{1..2}", "s3://bucket/in/*.gz"}
+	st = memStorage{"/in/a.gz": []byte("foo")}
+	err = jb.Init(fake.NewSimpleClientset(), fmt.Sprintf(":%v", freeport.GetPort()), "127.0.0.1", testConfig(st))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"part-1", "part-2", "s3://bucket/in/a.gz"}
+	if !reflect.DeepEqual(jb.Inputs, expected) {
+		t.Errorf("Expected Init to expand inputs to %v, got %v", expected, jb.Inputs)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	b, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := struct {
+		Properties  map[string]map[string]interface{} `json:"properties"`
+		Definitions map[string]interface{}            `json:"definitions"`
+	}{}
+	err = json.Unmarshal(b, &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Properties["inputs"]["type"] != "array" || schema.Properties["replicas"]["type"] != "integer" {
+		t.Errorf("Unexpected properties %v", schema.Properties)
+	}
+	if ref := schema.Properties["template"]["$ref"]; ref != "#/definitions/k8s.io.api.core.v1.PodTemplateSpec" {
+		t.Errorf("Unexpected template %v", ref)
+	}
+	if _, ok := schema.Definitions["k8s.io.api.core.v1.Container"]; !ok {
+		t.Error("Expected Container in definitions")
+	}
+	//What the master fills in is not offered to spec writers
+	for name := range statusFields {
+		if _, ok := schema.Properties[name]; ok {
+			t.Errorf("Expected no %s in properties", name)
+		}
+	}
+	if _, ok := schema.Definitions["github.com.turbobytes.kubemr.pkg.job.MapTask"]; ok {
+		t.Error("Expected no MapTask in definitions")
+	}
+}
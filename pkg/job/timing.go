@@ -0,0 +1,159 @@
+package job
+
+import (
+	"sort"
+	"time"
+)
+
+//slowestTasks is how many of the slowest tasks per phase go in the Summary
+const slowestTasks = 5
+
+//TaskTiming is stamped by the master as it handles task updates, whatever workers send is ignored
+type TaskTiming struct {
+	Acquired *time.Time `json:"acquired,omitempty"` //First time a worker acquired the task
+	Started  *time.Time `json:"started,omitempty"`  //When the current attempt started
+	Finished *time.Time `json:"finished,omitempty"` //When the task completed or failed
+	Attempts []Attempt  `json:"attempts,omitempty"`
+}
+
+//Attempt is a single run of a task by a worker
+type Attempt struct {
+	Worker   string     `json:"worker"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Seconds  float64    `json:"seconds"`
+	Status   string     `json:"status"`
+}
+
+//update stamps the times of a task moving from status from to status to
+//Returns the attempt that just finished, if any
+func (t *TaskTiming) update(worker, from, to string, now time.Time) *Attempt {
+	switch {
+	case to == StatusProgress && from == "":
+		if t.Acquired == nil {
+			t.Acquired = &now
+		}
+		t.Started = &now
+		t.Finished = nil
+		t.Attempts = append(t.Attempts, Attempt{Worker: worker, Started: now, Status: to})
+	case (to == StatusComplete || to == StatusFail) && from != to:
+		t.Finished = &now
+		if n := len(t.Attempts); n > 0 {
+			attempt := &t.Attempts[n-1]
+			attempt.Finished = &now
+			attempt.Seconds = now.Sub(attempt.Started).Seconds()
+			attempt.Status = to
+			return attempt
+		}
+	}
+	return nil
+}
+
+//release ends the current attempt of a task whose worker went away
+func (t *TaskTiming) release(now time.Time) {
+	t.Started = nil
+	if n := len(t.Attempts); n > 0 {
+		attempt := &t.Attempts[n-1]
+		attempt.Finished = &now
+		attempt.Seconds = now.Sub(attempt.Started).Seconds()
+		attempt.Status = StatusFail
+	}
+}
+
+//duration returns how long the current attempt ran, or has been running so far
+func (t *TaskTiming) duration() time.Duration {
+	if t.Started == nil {
+		return 0
+	}
+	if t.Finished == nil {
+		return time.Since(*t.Started)
+	}
+	return t.Finished.Sub(*t.Started)
+}
+
+//Summary describes where the time went once a job is over
+type Summary struct {
+	Started  time.Time                 `json:"started"`
+	Finished time.Time                 `json:"finished"`
+	Seconds  float64                   `json:"seconds"`
+	Phases   map[string]float64        `json:"phases"`  //Seconds spent in each phase
+	Slowest  map[string][]TaskSummary  `json:"slowest"` //Slowest tasks of each phase
+	Workers  map[string]*WorkerSummary `json:"workers"`
+}
+
+//TaskSummary is the time a task took
+type TaskSummary struct {
+	ID      int     `json:"id"`
+	Worker  string  `json:"worker"`
+	Seconds float64 `json:"seconds"`
+}
+
+//WorkerSummary is what a worker did during the job
+type WorkerSummary struct {
+	Tasks          int     `json:"tasks"`   //Completed tasks
+	Seconds        float64 `json:"seconds"` //Time spent in attempts, including failed ones
+	BytesRead      int64   `json:"bytesread"`
+	BytesWritten   int64   `json:"byteswritten"`
+	BytesPerSecond float64 `json:"bytespersecond"` //Bytes read and written per second busy
+}
+
+func (s *Summary) worker(name string) *WorkerSummary {
+	w, ok := s.Workers[name]
+	if !ok {
+		w = &WorkerSummary{}
+		s.Workers[name] = w
+	}
+	return w
+}
+
+//addTask accounts a task of phase
+func (s *Summary) addTask(phase string, id int, worker, status string, timing TaskTiming, read, written int64) {
+	for _, attempt := range timing.Attempts {
+		s.worker(attempt.Worker).Seconds += attempt.Seconds
+	}
+	if status != StatusComplete {
+		return
+	}
+	w := s.worker(worker)
+	w.Tasks++
+	w.BytesRead += read
+	w.BytesWritten += written
+	s.Slowest[phase] = append(s.Slowest[phase], TaskSummary{ID: id, Worker: worker, Seconds: timing.duration().Seconds()})
+}
+
+//summarize builds the Summary of a job that just ended. Caller must hold the job lock
+func (jb *MapReduceJob) summarize(now time.Time) *Summary {
+	s := &Summary{
+		Started:  jb.phaseTimes[StatusMap],
+		Finished: now,
+		Phases:   make(map[string]float64),
+		Slowest:  make(map[string][]TaskSummary),
+		Workers:  make(map[string]*WorkerSummary),
+	}
+	s.Seconds = now.Sub(s.Started).Seconds()
+	if reduce, ok := jb.phaseTimes[StatusReduce]; ok {
+		s.Phases["map"] = reduce.Sub(s.Started).Seconds()
+		s.Phases["reduce"] = now.Sub(reduce).Seconds()
+	} else {
+		s.Phases["map"] = s.Seconds
+	}
+	for id, m := range jb.Maps {
+		s.addTask("map", id, m.Worker, m.Status, m.TaskTiming, m.BytesRead, m.BytesWritten)
+	}
+	for id, r := range jb.Reduces {
+		s.addTask("reduce", id, r.Worker, r.Status, r.TaskTiming, r.BytesRead, r.BytesWritten)
+	}
+	for phase, tasks := range s.Slowest {
+		sort.Slice(tasks, func(i, j int) bool { return tasks[i].Seconds > tasks[j].Seconds })
+		if len(tasks) > slowestTasks {
+			tasks = tasks[:slowestTasks]
+		}
+		s.Slowest[phase] = tasks
+	}
+	for _, w := range s.Workers {
+		if w.Seconds > 0 {
+			w.BytesPerSecond = float64(w.BytesRead+w.BytesWritten) / w.Seconds
+		}
+	}
+	return s
+}
@@ -0,0 +1,208 @@
+package job
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	//Worker pod names are <name>-xxxxx, and must fit in a hostname for tasks to be released when pods die
+	maxNameLength = validation.DNS1123LabelMaxLength - 6
+	//Services are named kubemr-<name>-<runid>
+	maxServiceNameLength = validation.DNS1123LabelMaxLength - len("kubemr-") - 1
+)
+
+//Validate checks the job as submitted, before defaults are applied, returning all the problems found
+//It does not talk to Kubernetes, so it can be used to check jobs before running them
+func (jb *MapReduceJob) Validate() field.ErrorList {
+	errs := field.ErrorList{}
+	name := strings.ToLower(jb.Name)
+	if jb.Name == "" {
+		errs = append(errs, field.Required(field.NewPath("name"), "a name must be provided"))
+	} else {
+		for _, msg := range validation.IsDNS1123Label(name) {
+			errs = append(errs, field.Invalid(field.NewPath("name"), jb.Name, msg))
+		}
+		if len(name) > maxNameLength {
+			errs = append(errs, field.TooLong(field.NewPath("name"), jb.Name, maxNameLength))
+		}
+	}
+	if jb.RunID != "" {
+		for _, msg := range validation.IsDNS1123Label(jb.RunID) {
+			errs = append(errs, field.Invalid(field.NewPath("runid"), jb.RunID, msg))
+		}
+	}
+	for _, ns := range []struct {
+		path  string
+		value string
+	}{{"namespace", jb.Namespace}, {"workernamespace", jb.WorkerNamespace}} {
+		if ns.value == "" {
+			continue
+		}
+		for _, msg := range validation.IsDNS1123Label(ns.value) {
+			errs = append(errs, field.Invalid(field.NewPath(ns.path), ns.value, msg))
+		}
+	}
+	if len(jb.Inputs) == 0 && len(jb.InputSources) == 0 {
+		errs = append(errs, field.Required(field.NewPath("inputs"), "inputs or inputsources must be provided"))
+	}
+	for i, input := range jb.Inputs {
+		if input == "" {
+			errs = append(errs, field.Required(field.NewPath("inputs").Index(i), "inputs can not be empty"))
+			continue
+		}
+		//Init expands inputs, ranges can be checked up front while globs need storage
+		_, err := expandRanges(input)
+		if err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("inputs").Index(i), input, err.Error()))
+		}
+	}
+	for i, src := range jb.InputSources {
+		errs = append(errs, src.validate(field.NewPath("inputsources").Index(i))...)
+	}
+	errs = append(errs, jb.validateReplicas()...)
+	//Only check the templates that will be used, once each
+	checked := map[string]bool{}
+	for _, fleet := range []string{jb.fleet(StatusMap), jb.fleet(StatusReduce)} {
+		fld := field.NewPath("template")
+		switch {
+		case fleet == "map" && jb.MapTemplate != nil:
+			fld = field.NewPath("maptemplate")
+		case fleet == "reduce" && jb.ReduceTemplate != nil:
+			fld = field.NewPath("reducetemplate")
+		}
+		if !checked[fld.String()] {
+			errs = append(errs, validateTemplate(jb.template(fleet), fld)...)
+			checked[fld.String()] = true
+		}
+	}
+	switch jb.CleanupPolicy {
+	case "", CleanupOnSuccess, CleanupAlways, CleanupNever:
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("cleanuppolicy"), jb.CleanupPolicy, []string{CleanupOnSuccess, CleanupAlways, CleanupNever}))
+	}
+	switch jb.ConcurrencyPolicy {
+	case "", ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace:
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("concurrencypolicy"), jb.ConcurrencyPolicy, []string{ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace}))
+	}
+	errs = append(errs, jb.validateNetwork()...)
+	return errs
+}
+
+//validateReplicas checks the replica counts, along with the defaults of those not set
+func (jb *MapReduceJob) validateReplicas() field.ErrorList {
+	errs := field.ErrorList{}
+	counts := []struct {
+		path  string
+		value *int32
+		min   int32
+	}{
+		{"replicas", jb.Replicas, 1},
+		{"mapreplicas", jb.MapReplicas, 1},
+		{"reducereplicas", jb.ReduceReplicas, 1},
+		{"minreplicas", jb.MinReplicas, 1},
+		{"maxreplicas", jb.MaxReplicas, 1},
+		{"maxrestarts", jb.MaxRestarts, 0},
+	}
+	for _, count := range counts {
+		if count.value != nil && *count.value < count.min {
+			errs = append(errs, field.Invalid(field.NewPath(count.path), *count.value, fmt.Sprintf("must be at least %v", count.min)))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	orDefault := func(value *int32, def int32) int32 {
+		if value == nil {
+			return def
+		}
+		return *value
+	}
+	replicas := orDefault(jb.Replicas, defaultreplica)
+	mapreplicas, reducereplicas := replicas, replicas
+	if jb.fleet(StatusMap) != fleetAll {
+		mapreplicas, reducereplicas = orDefault(jb.MapReplicas, replicas), orDefault(jb.ReduceReplicas, replicas)
+	}
+	largest := mapreplicas
+	if reducereplicas > largest {
+		largest = reducereplicas
+	}
+	minreplicas, maxreplicas := orDefault(jb.MinReplicas, defaultreplica), orDefault(jb.MaxReplicas, largest)
+	for _, count := range []int32{mapreplicas, reducereplicas} {
+		if count < minreplicas || count > maxreplicas {
+			errs = append(errs, field.Invalid(field.NewPath("replicas"), count, fmt.Sprintf("must be between minreplicas %v and maxreplicas %v", minreplicas, maxreplicas)))
+			break
+		}
+	}
+	return errs
+}
+
+//validateTemplate checks what we need from a pod template, the apiserver checks the rest
+func validateTemplate(template *v1.PodTemplateSpec, fld *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	containers := fld.Child("spec", "containers")
+	if len(template.Spec.Containers) == 0 {
+		return append(errs, field.Required(containers, "at least one container is needed"))
+	}
+	for i, container := range template.Spec.Containers {
+		if container.Name == "" {
+			errs = append(errs, field.Required(containers.Index(i).Child("name"), ""))
+		}
+		if container.Image == "" {
+			errs = append(errs, field.Required(containers.Index(i).Child("image"), ""))
+		}
+	}
+	return errs
+}
+
+//validateNetwork checks how workers reach the master
+func (jb *MapReduceJob) validateNetwork() field.ErrorList {
+	errs := field.ErrorList{}
+	if jb.AdvertiseURL != "" {
+		u, err := url.Parse(jb.AdvertiseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, field.Invalid(field.NewPath("advertiseurl"), jb.AdvertiseURL, "must be an http(s) URL"))
+		}
+	}
+	switch jb.ServiceType {
+	case "":
+	case ServiceClusterIP, ServiceHeadless:
+		if jb.MasterPod == "" {
+			errs = append(errs, field.Required(field.NewPath("masterpod"), "needed by servicetype"))
+		}
+		runid := len(jb.RunID)
+		if runid == 0 {
+			runid = runIDLength
+		}
+		if len(jb.Name) > maxServiceNameLength-runid {
+			errs = append(errs, field.TooLong(field.NewPath("name"), jb.Name, maxServiceNameLength-runid))
+		}
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("servicetype"), jb.ServiceType, []string{ServiceClusterIP, ServiceHeadless}))
+	}
+	if jb.NetworkPolicy {
+		if jb.ServiceType == "" {
+			errs = append(errs, field.Required(field.NewPath("servicetype"), "needed by networkpolicy"))
+		}
+		namespace, workernamespace := jb.Namespace, jb.WorkerNamespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		if workernamespace == "" {
+			workernamespace = namespace
+		}
+		if jb.WorkerKubeconfig != "" || workernamespace != namespace {
+			errs = append(errs, field.Invalid(field.NewPath("networkpolicy"), jb.NetworkPolicy, "workers must run in the namespace of the master"))
+		}
+	}
+	if len(jb.NetworkPolicyFrom) > 0 && !jb.NetworkPolicy {
+		errs = append(errs, field.Invalid(field.NewPath("networkpolicyfrom"), jb.NetworkPolicyFrom, "only used with networkpolicy"))
+	}
+	return errs
+}
@@ -0,0 +1,124 @@
+package job
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+//watchWorkers tracks the worker pods, replacing the ones that die while the job runs
+func (jb *MapReduceJob) watchWorkers() {
+	selector := jb.workerSelector()
+	pods := jb.workerPods()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector
+			return pods.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			return pods.Watch(options)
+		},
+	}
+	informer := cache.NewSharedIndexInformer(lw, &v1.Pod{}, 0, cache.Indexers{})
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { jb.podChanged(obj, false) },
+		UpdateFunc: func(old, obj interface{}) { jb.podChanged(obj, false) },
+		DeleteFunc: func(obj interface{}) { jb.podChanged(obj, true) },
+	})
+	jb.watchStop = make(chan struct{})
+	go informer.Run(jb.watchStop)
+}
+
+//stopWatcher stops watching worker pods, so deleting them on cleanup is not mistaken for a failure
+func (jb *MapReduceJob) stopWatcher() {
+	if jb.watchStop != nil {
+		close(jb.watchStop)
+		jb.watchStop = nil
+	}
+}
+
+//podChanged handles a worker pod update, deleted is true if the pod is gone
+func (jb *MapReduceJob) podChanged(obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok || pod.Labels[runLabel] != jb.RunID {
+		return
+	}
+	//kubemrworker exits 0 on errors too, so a worker that is done for any reason has lost its tasks
+	if !deleted && pod.Status.Phase != v1.PodFailed && pod.Status.Phase != v1.PodSucceeded {
+		return
+	}
+	jb.Lock()
+	//Pods already lost or retired are no longer live
+	if !jb.live[pod.Name] || jb.Status == StatusComplete || jb.Status == StatusFail {
+		jb.Unlock()
+		return
+	}
+	delete(jb.live, pod.Name)
+	//Workers report their hostname, which is the pod name
+	released := jb.releaseTasks(pod.Name, time.Now())
+	replace := jb.Restarts < *jb.MaxRestarts
+	if replace {
+		jb.Restarts++
+		//Take the slot of the lost pod before letting go of the lock, so scale does not fill it too
+		jb.creating++
+	}
+	jb.Unlock()
+	reason := pod.Status.Reason
+	if reason == "" {
+		reason = string(pod.Status.Phase)
+	}
+	if deleted {
+		reason = "Deleted"
+	}
+	jb.record(Event{Type: EventPodLost, Pod: pod.Name, Message: fmt.Sprintf("Worker pod %s is gone (%s), released %v tasks", pod.Name, reason, released)})
+	if !replace {
+		log.Warnf("Worker pod %s is gone, not replacing it: %v restarts already", pod.Name, *jb.MaxRestarts)
+		return
+	}
+	jb.metrics.restarts.Inc()
+	p, err := jb.createWorker(pod.Labels["kubemr-fleet"])
+	jb.Lock()
+	defer jb.Unlock()
+	jb.creating--
+	if err != nil {
+		log.Errorf("Unable to replace worker pod %s: %s", pod.Name, err)
+		return
+	}
+	jb.live[p.Name] = true
+}
+
+//releaseTasks makes the tasks in progress on worker available to others. Caller must hold the job lock
+func (jb *MapReduceJob) releaseTasks(worker string, now time.Time) int {
+	released := 0
+	for taskid, task := range jb.Maps {
+		if task.Worker != worker || task.Status != StatusProgress {
+			continue
+		}
+		task.release(now)
+		task.Worker, task.Status, task.Progress = "", "", nil
+		jb.Maps[taskid] = task
+		jb.record(releaseEvent("map", taskid, worker))
+		released++
+	}
+	for taskid, task := range jb.Reduces {
+		if task.Worker != worker || task.Status != StatusProgress {
+			continue
+		}
+		task.release(now)
+		task.Worker, task.Status, task.Progress = "", "", nil
+		jb.Reduces[taskid] = task
+		jb.record(releaseEvent("reduce", taskid, worker))
+		released++
+	}
+	return released
+}
@@ -0,0 +1,171 @@
+package local
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/turbobytes/kubemr/pkg/job"
+	"github.com/turbobytes/kubemr/pkg/storage"
+	"github.com/turbobytes/kubemr/pkg/worker"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+//Bucket is the bucket name in URIs of objects kept by local jobs, e.g. s3://local/wordcount/<runid>/output/part-00000.txt
+const Bucket = "local"
+
+//Options tune how a job runs locally
+type Options struct {
+	Dir     string        //Where objects are kept, required
+	Workers int           //Number of workers, defaults to replicas of the job
+	Timeout time.Duration //Fail the job if it does not finish in time, defaults to 10 minutes
+	//Optional: Run workers as subprocesses running this command instead of in-process, e.g. a kubemrworker binary.
+	//They get the KUBEMR_* environment a worker pod would get, with KUBEMR_STORAGE_DIR pointing at Dir
+	Command []string
+}
+
+//Run runs jb to completion on this machine, without Kubernetes or S3
+//
+//The master serves on a free local port, worker pods are only created in a fake clientset, and Workers workers run
+//w in-process, or Command in subprocesses. Objects are files under Dir, read results back with Open.
+func Run(jb *job.MapReduceJob, w worker.JobWorker, opts Options) error {
+	if opts.Dir == "" {
+		return fmt.Errorf("Dir must be provided")
+	}
+	if w == nil && len(opts.Command) == 0 {
+		return fmt.Errorf("A JobWorker or Command must be provided")
+	}
+	if opts.Workers < 1 {
+		opts.Workers = job.DefaultReplicas
+		if jb.Replicas != nil {
+			opts.Workers = int(*jb.Replicas)
+		}
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Minute
+	}
+	st, err := storage.NewFS(opts.Dir)
+	if err != nil {
+		return err
+	}
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	cfg := &job.Config{
+		S3Region:   "us-east-1", //Not used, but has to be valid
+		BucketName: Bucket,
+		Storage:    st,
+	}
+	err = jb.Init(fake.NewSimpleClientset(), fmt.Sprintf(":%v", port), "127.0.0.1", cfg)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	stop := make(chan bool)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		//Workers give up on jobs that are not running yet
+		if !waitRunning(cfg.JobURL, stop) {
+			return
+		}
+		for i := 0; i < opts.Workers; i++ {
+			wg.Add(1)
+			name := fmt.Sprintf("%s-local-%v", jb.Name, i)
+			if len(opts.Command) > 0 {
+				go runCommand(&wg, opts, cfg, name, stop)
+			} else {
+				go runWorker(&wg, w, worker.NewLocalRunner(cfg.JobURL, name, worker.NewStorageUtilities(st, Bucket, cfg.BucketPrefix)))
+			}
+		}
+	}()
+	err = jb.Start(opts.Timeout)
+	close(stop)
+	wg.Wait()
+	return err
+}
+
+//Open opens an object kept by a local job under dir, like the URI of a result
+func Open(dir, uri string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(uri, "s3://"+Bucket+"/") {
+		return nil, fmt.Errorf("%s is not kept by local jobs", uri)
+	}
+	st := &storage.FS{Root: dir}
+	return st.Get(strings.TrimPrefix(uri, "s3://"+Bucket))
+}
+
+//freePort returns a local port nobody listens on
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+//waitRunning waits until the job at url is in the map phase or further, returns false if stop is closed first
+func waitRunning(url string, stop chan bool) bool {
+	cl := job.NewClient(url)
+	for {
+		jb, err := cl.GetJob()
+		if err == nil && jb.Status != job.StatusPending && jb.Status != job.StatusDeploying && jb.Status != job.StatusDeployed {
+			return true
+		}
+		select {
+		case <-stop:
+			return false
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+//runWorker runs an in-process worker until the job is over
+func runWorker(wg *sync.WaitGroup, w worker.JobWorker, r *worker.Runner) {
+	defer wg.Done()
+	//Workers return an error once the job is over, the master tells how it went
+	err := r.Run(w)
+	log.Debugf("Local worker exited: %v", err)
+}
+
+//runCommand runs a worker subprocess until it exits, or the job is over
+func runCommand(wg *sync.WaitGroup, opts Options, cfg *job.Config, name string, stop chan bool) {
+	defer wg.Done()
+	cmd := exec.Command(opts.Command[0], opts.Command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"KUBEMR_JOB_URL="+cfg.JobURL,
+		"KUBEMR_S3_REGION="+cfg.S3Region,
+		"KUBEMR_S3_BUCKET_NAME="+cfg.BucketName,
+		"KUBEMR_S3_BUCKET_PREFIX="+cfg.BucketPrefix,
+		"KUBEMR_STORAGE_DIR="+opts.Dir,
+		"KUBEMR_WORKER_NAME="+name,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Start()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err = <-done:
+	case <-stop:
+		//Give it a moment to notice the job is over
+		select {
+		case err = <-done:
+		case <-time.After(10 * time.Second):
+			cmd.Process.Kill()
+			err = <-done
+		}
+	}
+	log.Debugf("Local worker %s exited: %v", name, err)
+}
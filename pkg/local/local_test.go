@@ -0,0 +1,120 @@
+package local
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/turbobytes/kubemr/pkg/job"
+	"github.com/turbobytes/kubemr/pkg/worker"
+	"k8s.io/api/core/v1"
+)
+
+//wordCount counts words of local files into two partitions
+type wordCount struct{}
+
+func (wordCount) Map(id int, input string, utils *worker.Utilities) (map[int]string, error) {
+	b, err := ioutil.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+	partitions := make(map[int][]string)
+	for _, word := range strings.Fields(string(b)) {
+		p := len(word) % 2
+		partitions[p] = append(partitions[p], word)
+	}
+	outputs := make(map[int]string)
+	for p, words := range partitions {
+		f, err := ioutil.TempFile("", "")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(f.Name())
+		fmt.Fprintln(f, strings.Join(words, "\n"))
+		f.Close()
+		outputs[p], err = utils.UploadFilename(fmt.Sprintf("map/%v-%v.txt", id, p), f.Name())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
+
+func (wordCount) Reduce(id int, inputs []string, utils *worker.Utilities) (string, error) {
+	counts := make(map[string]int)
+	for _, input := range inputs {
+		rd, err := utils.GetS3Object(input)
+		if err != nil {
+			return "", err
+		}
+		scanner := bufio.NewScanner(rd)
+		for scanner.Scan() {
+			counts[scanner.Text()]++
+		}
+		rd.Close()
+	}
+	words := make([]string, 0, len(counts))
+	for word := range counts {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	for _, word := range words {
+		fmt.Fprintf(f, "%s\t%v\n", word, counts[word])
+	}
+	f.Close()
+	utils.IncrCounter(job.CounterOutputRecords, int64(len(words)))
+	return utils.UploadFilename(fmt.Sprintf("reduce/%v.txt", id), f.Name())
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	inputs := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")}
+	ioutil.WriteFile(inputs[0], []byte("to be or not to be"), 0644)
+	ioutil.WriteFile(inputs[1], []byte("be quick"), 0644)
+	jb := &job.MapReduceJob{Name: "wordcount", Inputs: inputs}
+	jb.Template.Spec.Containers = []v1.Container{{Name: "worker", Image: "none"}}
+	err = Run(jb, wordCount{}, Options{Dir: filepath.Join(dir, "storage"), Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jb.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %+v", jb.Results)
+	}
+	counts := make(map[string]int)
+	for _, result := range jb.Results {
+		rd, err := Open(filepath.Join(dir, "storage"), result.URI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(rd)
+		for scanner.Scan() {
+			fields := strings.Split(scanner.Text(), "\t")
+			counts[fields[0]], _ = strconv.Atoi(fields[1])
+		}
+		rd.Close()
+	}
+	expected := map[string]int{"to": 2, "be": 3, "or": 1, "not": 1, "quick": 1}
+	for word, n := range expected {
+		if counts[word] != n {
+			t.Errorf("Expected %s %v times, got %v", word, n, counts[word])
+		}
+	}
+	if jb.Counters.Total[job.CounterOutputRecords] != int64(len(expected)) {
+		t.Errorf("Expected %v output records, got %v", len(expected), jb.Counters.Total)
+	}
+}
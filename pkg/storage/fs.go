@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//FS keeps objects as files under Root, for running jobs without S3
+//Like S3, keys are listed without the leading /
+type FS struct {
+	Root string
+}
+
+//NewFS returns the storage rooted at dir, creating it if needed
+func NewFS(dir string) (*FS, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FS{Root: dir}, nil
+}
+
+//filename returns the file holding key
+func (st *FS) filename(key string) string {
+	return filepath.Join(st.Root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+//List returns all objects with keys starting with prefix
+func (st *FS) List(prefix string) ([]Object, error) {
+	prefix = strings.TrimPrefix(prefix, "/")
+	//Only walk the directory the prefix is in
+	dir := st.Root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = st.filename(prefix[:i])
+	}
+	objects := make([]Object, 0)
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".kubemr-") {
+			return nil
+		}
+		rel, err := filepath.Rel(st.Root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, Object{Key: key, Size: info.Size(), Modified: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+//Delete removes the object at key, it is not an error if there is none
+func (st *FS) Delete(key string) error {
+	err := os.Remove(st.filename(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+//Get opens the object at key for reading
+func (st *FS) Get(key string) (io.ReadCloser, error) {
+	return os.Open(st.filename(key))
+}
+
+//Put stores data at key
+func (st *FS) Put(key string, data []byte) error {
+	_, err := st.write(key, bytes.NewReader(data))
+	return err
+}
+
+//PutReader stores size bytes read from r at key
+func (st *FS) PutReader(key string, r io.Reader, size int64) error {
+	n, err := st.write(key, io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		st.Delete(key)
+		return fmt.Errorf("Expected %v bytes for %s, got %v", size, key, n)
+	}
+	return nil
+}
+
+//write stores what is read from r at key, through a temporary file so readers never see partial objects
+func (st *FS) write(key string, r io.Reader) (int64, error) {
+	name := st.filename(key)
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return 0, err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(name), ".kubemr-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	n, err := io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return n, err
+	}
+	err = f.Close()
+	if err != nil {
+		return n, err
+	}
+	return n, os.Rename(f.Name(), name)
+}
+
+//Copy copies the object at src to dst, returning the copy with its checksum
+func (st *FS) Copy(src, dst string) (Object, error) {
+	rd, err := st.Get(src)
+	if err != nil {
+		return Object{}, err
+	}
+	defer rd.Close()
+	h := sha256.New()
+	n, err := st.write(dst, io.TeeReader(rd, h))
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Key: dst, Size: n, Modified: time.Now(), Checksum: fmt.Sprintf("sha256:%x", h.Sum(nil))}, nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	st, err := NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Put("/test/a/1/map/0-1.txt", []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.PutReader("/test/a/1/reduce/1.txt", strings.NewReader("foo"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.PutReader("/test/a/1/reduce/2.txt", strings.NewReader("fo"), 3)
+	if err == nil {
+		t.Error("Expected error for short reader")
+	}
+	object, err := st.Copy("/test/a/1/reduce/1.txt", "/test/a/1/output/part-00001.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//sha256 of foo
+	if object.Size != 3 || object.Checksum != "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae" {
+		t.Errorf("Unexpected copy %+v", object)
+	}
+	objects, err := st.List("/test/a/1/re")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "test/a/1/reduce/1.txt" || objects[0].Size != 3 {
+		t.Errorf("Unexpected objects %+v", objects)
+	}
+	rd, err := st.Get("/test/a/1/output/part-00001.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(rd)
+	rd.Close()
+	if err != nil || string(b) != "foo" {
+		t.Errorf("Expected foo, got %s %v", b, err)
+	}
+	err = st.Put("/test/a/1/output/_SUCCESS", []byte(`{"runid":"1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Runs not written to for a day get swept
+	swept, err := Sweep(st, "/test/", time.Hour, time.Now().Add(24*time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(swept) != 1 || swept[0] != "test/a/1/" {
+		t.Errorf("Unexpected swept %v", swept)
+	}
+	objects, err = st.List("")
+	if err != nil || len(objects) != 0 {
+		t.Errorf("Expected everything to be deleted, got %v %v", objects, err)
+	}
+}
+
+//Test only kubemr runs under the prefix are swept
+func TestSweep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	st, err := NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := map[string]string{
+		"/test/a/1/_temporary/map-0-x/0-1.txt":  "foo",           //Run still holding task outputs
+		"/test/b/2/output/_SUCCESS":             `{"runid":"2"}`, //Completed and cleaned up run
+		"/test/b/3/output/_SUCCESS":             `{"runid":"x"}`, //Not the manifest of this run
+		"/test/logs/2026-10-15/a.gz":            "input",
+		"/test/results/daily/part-00000.txt":    "output",
+		"/testing/c/1/_temporary/map-0-x/0.txt": "other prefix",
+		"/d/1/_temporary/map-0-x/0-1.txt":       "outside the prefix",
+	}
+	for key, data := range objects {
+		err = st.Put(key, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = Sweep(st, "", time.Hour, time.Now().Add(24*time.Hour), false)
+	if err == nil {
+		t.Error("Expected the bucket root to be refused")
+	}
+	swept, err := Sweep(st, "test", time.Hour, time.Now().Add(24*time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(swept) != 2 || swept[0] != "test/a/1/" || swept[1] != "test/b/2/" {
+		t.Errorf("Expected test/a/1/ and test/b/2/ to be swept, got %v", swept)
+	}
+	left, err := st.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != len(objects)-2 {
+		t.Errorf("Expected everything else to survive, got %v", left)
+	}
+}
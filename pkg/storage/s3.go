@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/amz.v1/aws"
+	"gopkg.in/amz.v1/s3"
+)
+
+//S3 keeps objects in an S3 bucket
+type S3 struct {
+	Bucket *s3.Bucket
+}
+
+//NewS3 returns the storage for bucket. endpoint, if not empty, overrides the endpoint of region
+func NewS3(auth aws.Auth, region, endpoint, bucket string) (*S3, error) {
+	r, ok := aws.Regions[region]
+	if !ok {
+		return nil, fmt.Errorf("Region %s is invalid", region)
+	}
+	if endpoint != "" {
+		r.S3Endpoint = endpoint
+	}
+	return &S3{Bucket: s3.New(auth, r).Bucket(bucket)}, nil
+}
+
+//List returns all objects with keys starting with prefix
+func (st *S3) List(prefix string) ([]Object, error) {
+	//Keys are stored without the leading /
+	prefix = strings.TrimPrefix(prefix, "/")
+	objects := make([]Object, 0)
+	marker := ""
+	for {
+		resp, err := st.Bucket.List(prefix, "", marker, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range resp.Contents {
+			modified, err := time.Parse(time.RFC3339, key.LastModified)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, Object{Key: key.Key, Size: key.Size, Modified: modified})
+		}
+		if !resp.IsTruncated || len(resp.Contents) == 0 {
+			return objects, nil
+		}
+		marker = resp.NextMarker
+		if marker == "" {
+			marker = resp.Contents[len(resp.Contents)-1].Key
+		}
+	}
+}
+
+//Delete removes the object at key
+func (st *S3) Delete(key string) error {
+	return st.Bucket.Del(key)
+}
+
+//Get opens the object at key for reading
+func (st *S3) Get(key string) (io.ReadCloser, error) {
+	return st.Bucket.GetReader(key)
+}
+
+//Put stores data at key
+func (st *S3) Put(key string, data []byte) error {
+	return st.Bucket.Put(key, data, "application/octet-stream", s3.Private)
+}
+
+//PutReader stores size bytes read from r at key
+func (st *S3) PutReader(key string, r io.Reader, size int64) error {
+	return st.Bucket.PutReader(key, r, size, "application/octet-stream", s3.Private)
+}
+
+//Copy has S3 copy the object at src to dst, without the data passing through us
+//The checksum is the MD5 S3 reports, unknown for objects uploaded in parts
+func (st *S3) Copy(src, dst string) (Object, error) {
+	req, err := http.NewRequest(http.MethodPut, st.objectURL(dst), nil)
+	if err != nil {
+		return Object{}, err
+	}
+	req.Header.Set("x-amz-copy-source", "/"+st.Bucket.Name+escapeKey(src))
+	req.Header.Set("x-amz-acl", string(s3.Private))
+	signV4(req, st.Bucket.Auth, st.Bucket.Region.Name, time.Now())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Object{}, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Object{}, err
+	}
+	//Copies failing after they started still come with status 200, with an Error instead
+	result := struct {
+		XMLName xml.Name
+		ETag    string
+	}{}
+	err = xml.Unmarshal(body, &result)
+	if resp.StatusCode != http.StatusOK || err != nil || result.XMLName.Local != "CopyObjectResult" {
+		return Object{}, fmt.Errorf("Unable to copy %s to %s: %s %s", src, dst, resp.Status, strings.TrimSpace(string(body)))
+	}
+	objects, err := st.List(dst)
+	if err != nil {
+		return Object{}, err
+	}
+	for _, object := range objects {
+		if object.Key == strings.TrimPrefix(dst, "/") {
+			object.Key = dst
+			if etag := strings.Trim(result.ETag, `"`); len(etag) == 32 {
+				object.Checksum = "md5:" + etag
+			}
+			return object, nil
+		}
+	}
+	return Object{}, fmt.Errorf("Copy of %s to %s is missing", src, dst)
+}
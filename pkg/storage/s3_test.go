@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/amz.v1/aws"
+	"gopkg.in/amz.v1/s3"
+	"gopkg.in/amz.v1/s3/s3test"
+)
+
+func TestS3Sweep(t *testing.T) {
+	srv, err := s3test.NewServer(&s3test.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Quit()
+	region := aws.Region{
+		Name:                 "test",
+		S3Endpoint:           srv.URL(),
+		S3LocationConstraint: true, // s3test server requires a LocationConstraint
+		Sign:                 aws.SignV2,
+	}
+	st := &S3{Bucket: s3.New(aws.Auth{}, region).Bucket("foo")}
+	err = st.Bucket.PutBucket(s3.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"/test/a/1/_temporary/map-0-x/0-1.txt", "/test/a/1/_temporary/reduce-1-x/1.txt", "/test/a/2/_temporary/map-0-x/0-1.txt", "/other/c/1/map/0-1.txt"} {
+		err = st.Bucket.Put(key, []byte("foo"), "text/plain", s3.Private)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	objects, err := st.List("/test/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 3 {
+		t.Fatalf("Expected 3 objects under test/, got %v", objects)
+	}
+	//Everything was just written
+	swept, err := Sweep(st, "/test/", time.Hour, time.Now(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(swept) != 0 {
+		t.Errorf("Expected nothing to be swept, got %v", swept)
+	}
+	swept, err = Sweep(st, "/test/", time.Hour, time.Now().Add(2*time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(swept) != 2 || swept[0] != "test/a/1/" || swept[1] != "test/a/2/" {
+		t.Errorf("Expected test/a/1/ and test/a/2/ to be swept, got %v", swept)
+	}
+	objects, err = st.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "other/c/1/map/0-1.txt" {
+		t.Errorf("Expected only other/c/1/map/0-1.txt to be left, got %v", objects)
+	}
+}
+
+//Test copies are done by S3
+func TestS3Copy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/foo/other/c/1/output/part-00002.txt":
+			//Copies failing after they started come with 200
+			fmt.Fprint(w, `<Error><Code>InternalError</Code></Error>`)
+		case r.Method == http.MethodPut:
+			if r.URL.Path != "/foo/other/c/1/output/part-00001.txt" || r.Header.Get("x-amz-copy-source") != "/foo/test/a/1/_temporary/reduce-1-x/1.txt" {
+				http.Error(w, "unexpected copy "+r.URL.Path, http.StatusBadRequest)
+				return
+			}
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || r.ContentLength > 0 {
+				http.Error(w, "unexpected request", http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `<CopyObjectResult><LastModified>2026-10-18T12:00:00.000Z</LastModified><ETag>"acbd18db4cc2f85cedef654fccc4a4d8"</ETag></CopyObjectResult>`)
+		case r.URL.Query().Get("prefix") == "other/c/1/output/part-00001.txt":
+			fmt.Fprint(w, `<ListBucketResult><Name>foo</Name><IsTruncated>false</IsTruncated><Contents><Key>other/c/1/output/part-00001.txt</Key><LastModified>2026-10-18T12:00:00.000Z</LastModified><Size>3</Size></Contents></ListBucketResult>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	region := aws.Region{Name: "us-east-1", S3Endpoint: srv.URL, Sign: aws.SignV2}
+	st := &S3{Bucket: s3.New(aws.Auth{AccessKey: "AKID", SecretKey: "secret"}, region).Bucket("foo")}
+	object, err := st.Copy("/test/a/1/_temporary/reduce-1-x/1.txt", "/other/c/1/output/part-00001.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//md5 of foo
+	if object.Key != "/other/c/1/output/part-00001.txt" || object.Size != 3 || object.Checksum != "md5:acbd18db4cc2f85cedef654fccc4a4d8" {
+		t.Errorf("Unexpected copy %+v", object)
+	}
+	_, err = st.Copy("/test/a/1/_temporary/reduce-1-x/1.txt", "/other/c/1/output/part-00002.txt")
+	if err == nil {
+		t.Error("Expected a failed copy to be reported")
+	}
+}
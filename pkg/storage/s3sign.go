@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/amz.v1/aws"
+)
+
+//AWS signature version 4, for the requests amz does not make for us
+
+const (
+	v4Algorithm  = "AWS4-HMAC-SHA256"
+	v4TimeFormat = "20060102T150405Z"
+	emptySHA256  = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+//escapeKey encodes key for use in a path, leaving only the characters AWS leaves alone, and /
+func escapeKey(key string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+//objectURL returns the path style URL of key, which starts with /
+func (st *S3) objectURL(key string) string {
+	return strings.TrimSuffix(st.Bucket.Region.S3Endpoint, "/") + "/" + st.Bucket.Name + escapeKey(key)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+//v4Scope returns the credential scope of requests made at date
+func v4Scope(region string, date time.Time) string {
+	return date.Format("20060102") + "/" + region + "/s3/aws4_request"
+}
+
+//v4Signature signs the canonical request made at date
+func v4Signature(auth aws.Auth, region string, date time.Time, canonical string) string {
+	h := sha256.Sum256([]byte(canonical))
+	toSign := v4Algorithm + "\n" + date.Format(v4TimeFormat) + "\n" + v4Scope(region, date) + "\n" + hex.EncodeToString(h[:])
+	key := hmacSHA256([]byte("AWS4"+auth.SecretKey), date.Format("20060102"))
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+//signV4 adds the Authorization header to a request without a body, signing all headers set on it
+func signV4(req *http.Request, auth aws.Auth, region string, now time.Time) {
+	date := now.UTC()
+	req.Header.Set("x-amz-date", date.Format(v4TimeFormat))
+	req.Header.Set("x-amz-content-sha256", emptySHA256)
+	names := []string{"host"}
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var headers bytes.Buffer
+	for _, name := range names {
+		value := req.URL.Host
+		if name != "host" {
+			value = req.Header.Get(name)
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, headers.String(), signed, emptySHA256}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		v4Algorithm, auth.AccessKey, v4Scope(region, date), signed, v4Signature(auth, region, date, canonical)))
+}
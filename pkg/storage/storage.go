@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+//Object is an item kept in storage
+type Object struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+	Checksum string //sha256:<hex> or md5:<hex>, only known for objects just copied
+}
+
+//Storage is where kubemr keeps intermediate and final outputs
+type Storage interface {
+	//List returns all objects with keys starting with prefix
+	List(prefix string) ([]Object, error)
+	//Delete removes the object at key
+	Delete(key string) error
+	//Get opens the object at key for reading
+	Get(key string) (io.ReadCloser, error)
+	//Put stores data at key
+	Put(key string, data []byte) error
+	//PutReader stores size bytes read from r at key
+	PutReader(key string, r io.Reader, size int64) error
+	//Copy copies the object at src to dst, returning the copy with its checksum if known
+	Copy(src, dst string) (Object, error)
+}
+
+//DeletePrefix deletes all objects under prefix, returning how many were deleted
+func DeletePrefix(st Storage, prefix string) (int, error) {
+	objects, err := st.List(prefix)
+	if err != nil {
+		return 0, err
+	}
+	for i, object := range objects {
+		err = st.Delete(object.Key)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(objects), nil
+}
+
+//temporaryDir holds what task attempts write under a run prefix, like job.TemporaryDir
+const temporaryDir = "_temporary/"
+
+//Sweep deletes the run prefixes (<root><job name>/<run id>/) that have not been written to for ttl
+//Only prefixes that are clearly kubemr runs are considered, those holding outputs of task attempts or
+//an output/_SUCCESS manifest of the run. Returns the prefixes deleted, or that would be if dryrun is set
+func Sweep(st Storage, root string, ttl time.Duration, now time.Time, dryrun bool) ([]string, error) {
+	root = strings.TrimPrefix(root, "/")
+	if root == "" {
+		return nil, fmt.Errorf("A bucket prefix is required, the bucket root is not swept")
+	}
+	if !strings.HasSuffix(root, "/") {
+		root = root + "/"
+	}
+	objects, err := st.List(root)
+	if err != nil {
+		return nil, err
+	}
+	//Last write to each run prefix
+	modified := make(map[string]time.Time)
+	runs := make(map[string]bool)
+	for _, object := range objects {
+		key := strings.TrimPrefix(object.Key, "/")
+		parts := strings.SplitN(strings.TrimPrefix(key, root), "/", 3)
+		if len(parts) < 3 {
+			//Not inside a run prefix
+			continue
+		}
+		prefix := root + parts[0] + "/" + parts[1] + "/"
+		if object.Modified.After(modified[prefix]) {
+			modified[prefix] = object.Modified
+		}
+		switch {
+		case strings.HasPrefix(parts[2], temporaryDir):
+			runs[prefix] = true
+		case parts[2] == "output/_SUCCESS" && isManifestOf(st, key, parts[1]):
+			runs[prefix] = true
+		}
+	}
+	swept := make([]string, 0)
+	for prefix, last := range modified {
+		if runs[prefix] && now.Sub(last) >= ttl {
+			swept = append(swept, prefix)
+		}
+	}
+	sort.Strings(swept)
+	if dryrun {
+		return swept, nil
+	}
+	for i, prefix := range swept {
+		_, err = DeletePrefix(st, prefix)
+		if err != nil {
+			return swept[:i], err
+		}
+	}
+	return swept, nil
+}
+
+//isManifestOf tells if key holds the _SUCCESS manifest of run id
+func isManifestOf(st Storage, key, id string) bool {
+	rd, err := st.Get("/" + key)
+	if err != nil {
+		return false
+	}
+	defer rd.Close()
+	//Only the run ID of job.Manifest
+	manifest := struct {
+		RunID string `json:"runid"`
+	}{}
+	err = json.NewDecoder(rd).Decode(&manifest)
+	return err == nil && manifest.RunID == id
+}
@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//Tracer returns the tracer used by all kubemr packages
+//Spans are dropped unless Init was called with an endpoint
+func Tracer() trace.Tracer {
+	return otel.Tracer("github.com/turbobytes/kubemr")
+}
+
+//Init exports spans over OTLP/HTTP to endpoint, e.g. http://otel-collector:4318
+//Blank endpoint disables tracing. Call the returned func before exiting to flush pending spans
+func Init(service, endpoint string) (func(), error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if endpoint == "" {
+		return func() {}, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	)
+	otel.SetTracerProvider(tp)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		tp.Shutdown(ctx)
+	}, nil
+}
+
+//InitEnv calls Init with the endpoint from KUBEMR_OTLP_ENDPOINT
+func InitEnv(service string) (func(), error) {
+	return Init(service, os.Getenv("KUBEMR_OTLP_ENDPOINT"))
+}
+
+//EndSpan ends span, recording err if any
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInit(t *testing.T) {
+	//Stand in for a local collector
+	var received int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" {
+			atomic.AddInt32(&received, 1)
+		}
+	}))
+	defer srv.Close()
+	shutdown, err := Init("test", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Tracer().Start(context.Background(), "foo")
+	span.End()
+	shutdown()
+	if atomic.LoadInt32(&received) == 0 {
+		t.Error("Expected spans to be exported to the collector")
+	}
+}
+
+func TestInitDisabled(t *testing.T) {
+	shutdown, err := Init("test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutdown()
+}
@@ -0,0 +1,264 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/turbobytes/kubemr/pkg/job"
+	"github.com/turbobytes/kubemr/pkg/jsonpatch"
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//Resource is a MapReduceJob stored as a Kubernetes resource, the job the master is given is its spec
+type Resource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              job.MapReduceJob `json:"spec"`
+}
+
+//Server answers AdmissionReviews for MapReduceJob resources
+//
+//The spec of the resource under review is checked as the job, named after the resource.
+//Register /mutate with a MutatingWebhookConfiguration and /validate with a ValidatingWebhookConfiguration.
+type Server struct {
+	Limits v1.ResourceList //Resource limits given to worker containers that do not set them
+}
+
+//Handler returns the http handler serving /mutate and /validate
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mutate", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, s.Mutate)
+	})
+	mux.HandleFunc("/validate", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, s.Validate)
+	})
+	return mux
+}
+
+//ListenAndServeTLS serves the webhook on addr, the apiserver only talks to webhooks over https
+func (s *Server) ListenAndServeTLS(addr, certfile, keyfile string) error {
+	return http.ListenAndServeTLS(addr, certfile, keyfile, s.Handler())
+}
+
+//serve decodes an AdmissionReview, and responds with what admit says about it
+func serve(w http.ResponseWriter, r *http.Request, admit func(*v1beta1.AdmissionRequest) *v1beta1.AdmissionResponse) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	review := &v1beta1.AdmissionReview{}
+	err = json.Unmarshal(b, review)
+	if err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("Expected an AdmissionReview: %v", err), http.StatusBadRequest)
+		return
+	}
+	review.Response = admit(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(review)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+//deny rejects the request with msg
+func deny(msg string) *v1beta1.AdmissionResponse {
+	return &v1beta1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Message: msg,
+			Code:    http.StatusUnprocessableEntity,
+		},
+	}
+}
+
+//decode returns the resource under review, along with its raw JSON document.
+//The job takes the name of the resource unless its spec names it
+func decode(req *v1beta1.AdmissionRequest) (*Resource, map[string]interface{}, error) {
+	res := &Resource{}
+	err := json.Unmarshal(req.Object.Raw, res)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc := make(map[string]interface{})
+	err = json.Unmarshal(req.Object.Raw, &doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := doc["spec"].(map[string]interface{}); !ok {
+		return nil, nil, fmt.Errorf("spec: Required value")
+	}
+	if res.Spec.Name == "" {
+		res.Spec.Name = res.Name
+	}
+	return res, doc, nil
+}
+
+//Validate rejects jobs the master would refuse to run, listing every problem
+func (s *Server) Validate(req *v1beta1.AdmissionRequest) *v1beta1.AdmissionResponse {
+	if req.Operation == v1beta1.Delete {
+		return &v1beta1.AdmissionResponse{Allowed: true}
+	}
+	res, _, err := decode(req)
+	if err != nil {
+		return deny(err.Error())
+	}
+	errs := res.Spec.Validate()
+	if len(errs) > 0 {
+		//Point at the fields of the resource
+		for _, e := range errs {
+			e.Field = "spec." + e.Field
+		}
+		return deny(errs.ToAggregate().Error())
+	}
+	return &v1beta1.AdmissionResponse{Allowed: true}
+}
+
+//Mutate fills in defaults for the name, replicas, namespace and the worker pod templates of the spec with a JSON patch
+func (s *Server) Mutate(req *v1beta1.AdmissionRequest) *v1beta1.AdmissionResponse {
+	if req.Operation == v1beta1.Delete {
+		return &v1beta1.AdmissionResponse{Allowed: true}
+	}
+	res, doc, err := decode(req)
+	if err != nil {
+		return deny(err.Error())
+	}
+	namespace := res.Namespace
+	if namespace == "" {
+		namespace = req.Namespace
+	}
+	patch := s.defaults(&res.Spec, doc, namespace)
+	if len(patch) == 0 {
+		return &v1beta1.AdmissionResponse{Allowed: true}
+	}
+	b, err := json.Marshal(patch)
+	if err != nil {
+		return deny(err.Error())
+	}
+	patchtype := v1beta1.PatchTypeJSONPatch
+	return &v1beta1.AdmissionResponse{Allowed: true, Patch: b, PatchType: &patchtype}
+}
+
+//defaults returns the patch setting what is missing from the spec of doc, jb is the decoded spec
+func (s *Server) defaults(jb *job.MapReduceJob, doc map[string]interface{}, namespace string) jsonpatch.Patch {
+	patch := jsonpatch.New()
+	//Keep the name validated along with the spec
+	if jb.Name != "" {
+		patch = addMissing(patch, doc, []string{"spec", "name"}, jb.Name)
+	}
+	if jb.Replicas == nil {
+		patch = addMissing(patch, doc, []string{"spec", "replicas"}, job.DefaultReplicas)
+	}
+	if jb.Namespace == "" {
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		patch = addMissing(patch, doc, []string{"spec", "namespace"}, namespace)
+	}
+	//Sorted, so the same job always gets the same patch
+	names := make([]v1.ResourceName, 0, len(s.Limits))
+	for name := range s.Limits {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	templates := []struct {
+		key      string
+		template *v1.PodTemplateSpec
+	}{{"template", &jb.Template}, {"maptemplate", jb.MapTemplate}, {"reducetemplate", jb.ReduceTemplate}}
+	for _, t := range templates {
+		//Missing templates are left for validation to complain about
+		if _, ok := lookup(doc["spec"], t.key); !ok || t.template == nil {
+			continue
+		}
+		//The master runs workers with restartPolicy Never whatever the template says, make it visible
+		switch t.template.Spec.RestartPolicy {
+		case v1.RestartPolicyNever:
+		case "":
+			patch = addMissing(patch, doc, []string{"spec", t.key, "spec", "restartPolicy"}, v1.RestartPolicyNever)
+		default:
+			patch = patch.Add("replace", pointer([]string{"spec", t.key, "spec", "restartPolicy"}), v1.RestartPolicyNever)
+		}
+		for i, container := range t.template.Spec.Containers {
+			for _, name := range names {
+				if _, ok := container.Resources.Limits[name]; ok {
+					continue
+				}
+				quantity := s.Limits[name]
+				patch = addMissing(patch, doc, []string{"spec", t.key, "spec", "containers", strconv.Itoa(i), "resources", "limits", string(name)}, quantity.String())
+			}
+		}
+	}
+	return patch
+}
+
+//lookup returns the child of node at key, key is an index for arrays
+func lookup(node interface{}, key string) (interface{}, bool) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[key]
+		return child, ok && child != nil
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(n) {
+			return nil, false
+		}
+		return n[i], n[i] != nil
+	}
+	return nil, false
+}
+
+//addMissing adds value at path unless it is set, creating whatever parents are missing.
+//The parents are added to doc as well, so later patches see them
+func addMissing(patch jsonpatch.Patch, doc map[string]interface{}, path []string, value interface{}) jsonpatch.Patch {
+	var node interface{} = doc
+	for i, key := range path {
+		child, ok := lookup(node, key)
+		if ok {
+			node = child
+			continue
+		}
+		parent, ok := node.(map[string]interface{})
+		if !ok {
+			//Can not add keys to arrays or scalars
+			return patch
+		}
+		//Build what is missing from here down, separately for doc and the patch so adding to doc later does not change the patch
+		build := func() interface{} {
+			v := value
+			for j := len(path) - 1; j > i; j-- {
+				v = map[string]interface{}{path[j]: v}
+			}
+			return v
+		}
+		parent[key] = build()
+		return patch.Add("add", pointer(path[:i+1]), build())
+	}
+	return patch
+}
+
+//pointer escapes path into a JSON pointer
+func pointer(path []string) string {
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	escaped := make([]string, len(path))
+	for i, key := range path {
+		escaped[i] = escaper.Replace(key)
+	}
+	return "/" + strings.Join(escaped, "/")
+}
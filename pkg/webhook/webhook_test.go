@@ -0,0 +1,123 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/turbobytes/kubemr/pkg/jsonpatch"
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func review(t *testing.T, url, object string) *v1beta1.AdmissionResponse {
+	rv := v1beta1.AdmissionReview{Request: &v1beta1.AdmissionRequest{
+		UID:       "abc",
+		Operation: v1beta1.Create,
+		Namespace: "batch",
+		Object:    runtime.RawExtension{Raw: []byte(object)},
+	}}
+	b, err := json.Marshal(rv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Got status %s", resp.Status)
+	}
+	rv = v1beta1.AdmissionReview{}
+	err = json.NewDecoder(resp.Body).Decode(&rv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rv.Response == nil || rv.Response.UID != "abc" {
+		t.Fatalf("Expected response to request abc, got %+v", rv.Response)
+	}
+	return rv.Response
+}
+
+func TestValidate(t *testing.T) {
+	srv := httptest.NewServer((&Server{}).Handler())
+	defer srv.Close()
+	//The job is named after the resource
+	resp := review(t, srv.URL+"/validate", `{"apiVersion": "kubemr.turbobytes.com/v1alpha1", "kind": "MapReduceJob", "metadata": {"name": "foo", "namespace": "batch"},
+		"spec": {"inputs": ["a", "rfc{4501..4510}.txt", "s3://logs/*.gz"], "template": {"spec": {"containers": [{"name": "w", "image": "worker"}]}}}}`)
+	if !resp.Allowed {
+		t.Errorf("Expected valid job to be allowed, got %v", resp.Result)
+	}
+	resp = review(t, srv.URL+"/validate", `{"apiVersion": "kubemr.turbobytes.com/v1alpha1", "kind": "MapReduceJob", "metadata": {"name": "foo"},
+		"spec": {"name": "foo_bar", "inputs": ["part-{9..1}"], "template": {"spec": {"containers": [{"name": "w"}]}}}}`)
+	if resp.Allowed {
+		t.Fatal("Expected invalid job to be denied")
+	}
+	for _, fld := range []string{"spec.name", "spec.inputs[0]", "spec.template.spec.containers[0].image"} {
+		if !strings.Contains(resp.Result.Message, fld) {
+			t.Errorf("Expected %s in %s", fld, resp.Result.Message)
+		}
+	}
+}
+
+func TestMutate(t *testing.T) {
+	s := &Server{Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")}}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	resp := review(t, srv.URL+"/mutate", `{"apiVersion": "kubemr.turbobytes.com/v1alpha1", "kind": "MapReduceJob", "metadata": {"name": "foo"},
+		"spec": {"inputs": ["a"], "template": {"spec": {"restartPolicy": "Always", "containers": [{"name": "w", "image": "worker", "resources": {"limits": {"cpu": "2"}}}, {"name": "sidecar", "image": "sidecar"}]}}}}`)
+	if !resp.Allowed || resp.PatchType == nil || *resp.PatchType != v1beta1.PatchTypeJSONPatch {
+		t.Fatalf("Expected a JSON patch, got %+v", resp)
+	}
+	patch := jsonpatch.New()
+	err := json.Unmarshal(resp.Patch, &patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, item := range patch {
+		b, _ := json.Marshal(item.Value)
+		got[item.Op+" "+item.Path] = string(b)
+	}
+	expected := map[string]string{
+		"add /spec/name":                            `"foo"`,
+		"add /spec/replicas":                        `1`,
+		"add /spec/namespace":                       `"batch"`,
+		"replace /spec/template/spec/restartPolicy": `"Never"`,
+		"add /spec/template/spec/containers/0/resources/limits/memory": `"1Gi"`,
+		"add /spec/template/spec/containers/1/resources":               `{"limits":{"cpu":"1"}}`,
+		"add /spec/template/spec/containers/1/resources/limits/memory": `"1Gi"`,
+	}
+	if len(got) != len(expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	for k, v := range expected {
+		if got[k] != v {
+			t.Errorf("Expected %s to be %s, got %s", k, v, got[k])
+		}
+	}
+}
+
+//Test documents without a spec are denied rather than patched at the root
+func TestMissingSpec(t *testing.T) {
+	srv := httptest.NewServer((&Server{}).Handler())
+	defer srv.Close()
+	for _, path := range []string{"/validate", "/mutate"} {
+		resp := review(t, srv.URL+path, `{"apiVersion": "kubemr.turbobytes.com/v1alpha1", "kind": "MapReduceJob", "metadata": {"name": "foo"}}`)
+		if resp.Allowed || !strings.Contains(resp.Result.Message, "spec") {
+			t.Errorf("Expected %s to deny a resource without spec, got %+v", path, resp)
+		}
+	}
+}
+
+func TestPointer(t *testing.T) {
+	if p := pointer([]string{"limits", "nvidia.com/gpu", "a~b"}); p != "/limits/nvidia.com~1gpu/a~0b" {
+		t.Errorf("Got %s", p)
+	}
+}
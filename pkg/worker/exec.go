@@ -0,0 +1,157 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//ExecWorker is a JobWorker that runs an external command for each map and reduce task
+//
+//The command gets the task as JSON on stdin and in KUBEMR_TASK_* env variables.
+//It must print a JSON object on stdout, {"outputs":{"0":"..."}} for map and {"output":"..."} for reduce,
+//optionally with "counters":{"name":1} to report counters.
+//Outputs starting with file:// are uploaded by the worker, anything else is passed along as is.
+type ExecWorker struct {
+	MapCmd    []string //Command and args run for every map task
+	ReduceCmd []string //Command and args run for every reduce task
+}
+
+//ExecTask is what the command receives on stdin
+type ExecTask struct {
+	ID     int      `json:"id"`
+	Phase  string   `json:"phase"`            //map or reduce
+	Input  string   `json:"input,omitempty"`  //Map input
+	Inputs []string `json:"inputs,omitempty"` //Reduce inputs, downloaded to local files when managed by kubemr
+	Dir    string   `json:"dir"`              //Scratch directory for the command, removed after the task
+}
+
+//ExecResult is what the command must print on stdout
+type ExecResult struct {
+	Outputs  map[int]string   `json:"outputs"`  //Map outputs by partition
+	Output   string           `json:"output"`   //Reduce output
+	Counters map[string]int64 `json:"counters"` //Optional, added to the task counters
+}
+
+//Map runs MapCmd
+func (w *ExecWorker) Map(id int, input string, utils *Utilities) (map[int]string, error) {
+	dir, err := ioutil.TempDir("", "kubemr")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	task := ExecTask{ID: id, Phase: "map", Input: input, Dir: dir}
+	res, err := runExec(w.MapCmd, task, utils)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make(map[int]string)
+	for partition, output := range res.Outputs {
+		outputs[partition], err = uploadExecOutput(utils, dir, fmt.Sprintf("map/%v-%v", id, partition), output)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
+
+//Reduce runs ReduceCmd
+func (w *ExecWorker) Reduce(id int, inputs []string, utils *Utilities) (string, error) {
+	dir, err := ioutil.TempDir("", "kubemr")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	task := ExecTask{ID: id, Phase: "reduce", Dir: dir}
+	//Download inputs we manage so the command does not need S3 access
+	for i, input := range inputs {
+		local, err := downloadExecInput(utils, input, filepath.Join(dir, fmt.Sprintf("input-%v", i)))
+		if err != nil {
+			return "", err
+		}
+		task.Inputs = append(task.Inputs, local)
+	}
+	res, err := runExec(w.ReduceCmd, task, utils)
+	if err != nil {
+		return "", err
+	}
+	return uploadExecOutput(utils, dir, fmt.Sprintf("reduce/%v", id), res.Output)
+}
+
+func runExec(command []string, task ExecTask, utils *Utilities) (*ExecResult, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("No command configured for %s", task.Phase)
+	}
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"KUBEMR_TASK_PHASE="+task.Phase,
+		"KUBEMR_TASK_ID="+strconv.Itoa(task.ID),
+		"KUBEMR_TASK_INPUT="+task.Input,
+		"KUBEMR_TASK_INPUTS="+strings.Join(task.Inputs, "\n"),
+		"KUBEMR_TASK_DIR="+task.Dir,
+	)
+	cmd.Dir = task.Dir
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = os.Stderr
+	stdout := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("%s %v: %s", task.Phase, task.ID, err)
+	}
+	res := &ExecResult{}
+	err = json.Unmarshal(stdout.Bytes(), res)
+	if err != nil {
+		return nil, fmt.Errorf("%s %v: unable to parse output: %s", task.Phase, task.ID, err)
+	}
+	for name, delta := range res.Counters {
+		utils.IncrCounter(name, delta)
+	}
+	return res, nil
+}
+
+//downloadExecInput copies a kubemr managed object to dst, other inputs are returned untouched
+func downloadExecInput(utils *Utilities, input, dst string) (string, error) {
+	if !strings.HasPrefix(input, "s3://"+utils.bucket+"/") {
+		return input, nil
+	}
+	rd, err := utils.GetS3Object(input)
+	if err != nil {
+		return "", err
+	}
+	defer rd.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, rd)
+	if err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+//uploadExecOutput uploads file:// outputs into key, other outputs are returned untouched
+//Relative paths are relative to the task directory
+func uploadExecOutput(utils *Utilities, dir, key, output string) (string, error) {
+	if !strings.HasPrefix(output, "file://") {
+		return output, nil
+	}
+	src := strings.TrimPrefix(output, "file://")
+	if !filepath.IsAbs(src) {
+		src = filepath.Join(dir, src)
+	}
+	return utils.UploadFilename(key+filepath.Ext(src), src)
+}
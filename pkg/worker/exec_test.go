@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestExecWorker(t *testing.T) {
+	utils, quit := testUtilities(t)
+	defer quit()
+	w := &ExecWorker{
+		MapCmd: []string{"sh", "-c", `printf "$KUBEMR_TASK_INPUT\t1\n" > part.txt && echo '{"outputs":{"0":"file://part.txt","1":"http://example.com/"},"counters":{"lines":1}}'`},
+		//Concatenate all inputs
+		ReduceCmd: []string{"sh", "-c", `cat $KUBEMR_TASK_INPUTS > out.txt && echo '{"output":"file://out.txt"}'`},
+	}
+	outputs, err := w.Map(3, "hello", utils)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs[0] != "s3://foo/foo/map/3-0.txt" {
+		t.Errorf("Expected s3://foo/foo/map/3-0.txt, got %s", outputs[0])
+	}
+	if outputs[1] != "http://example.com/" {
+		t.Errorf("Expected non file outputs to pass through, got %s", outputs[1])
+	}
+	if c := utils.resetCounters()["lines"]; c != 1 {
+		t.Errorf("Expected counter lines to be 1, got %v", c)
+	}
+	output, err := w.Reduce(0, []string{outputs[0], outputs[0]}, utils)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "s3://foo/foo/reduce/0.txt" {
+		t.Errorf("Expected s3://foo/foo/reduce/0.txt, got %s", output)
+	}
+	item, err := utils.GetS3Object(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer item.Close()
+	d, err := ioutil.ReadAll(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != "hello\t1\nhello\t1\n" {
+		t.Errorf("Unexpected reduce output %q", d)
+	}
+	//Broken command
+	w.MapCmd = []string{"sh", "-c", "echo notjson"}
+	_, err = w.Map(0, "hello", utils)
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
@@ -13,28 +13,30 @@ type Group struct {
 }
 
 //KVGroup groups continous items by keys in a pre-sorted reader
+//Lines without sep have a nil value, an empty value after sep is not nil
 func KVGroup(input io.Reader, g chan *Group, sep string) {
 	scanner := bufio.NewScanner(input)
 	//g := make(chan *Groups)
-	group := &Group{Key: ""}
+	var group *Group
 	for scanner.Scan() {
 		byt := scanner.Text()
 		splitted := strings.SplitN(byt, sep, 2)
 		k := splitted[0]
-		v := []byte(splitted[1])
-		if group.Key == "" {
-			//First grouping...
-			group = &Group{Key: k, Vals: make(chan []byte)}
-			g <- group
-		} else if group.Key != k {
-			//Had previous group, now making new...
-			close(group.Vals)
+		var v []byte
+		if len(splitted) > 1 {
+			v = []byte(splitted[1])
+		}
+		//Empty keys are keys too, so a nil group tells there is none yet
+		if group == nil || group.Key != k {
+			if group != nil {
+				close(group.Vals)
+			}
 			group = &Group{Key: k, Vals: make(chan []byte)}
 			g <- group
 		}
 		group.Vals <- v
 	}
-	if group.Key != "" {
+	if group != nil {
 		//We ever had a group means last is still unclosed...
 		close(group.Vals)
 	}
@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+//runnerMetrics holds the prometheus metrics of a worker
+type runnerMetrics struct {
+	registry *prometheus.Registry
+	tasks    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	bytes    *prometheus.CounterVec
+}
+
+func newRunnerMetrics() *runnerMetrics {
+	m := &runnerMetrics{
+		registry: prometheus.NewRegistry(),
+		tasks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kubemr_worker_tasks_total",
+			Help: "Number of tasks run by this worker",
+		}, []string{"phase", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kubemr_worker_task_duration_seconds",
+			Help:    "Time spent in user code per task",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 14), //1s to ~2h
+		}, []string{"phase"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kubemr_worker_bytes_total",
+			Help: "Bytes read and written through Utilities",
+		}, []string{"phase", "direction"}),
+	}
+	m.registry.MustRegister(m.tasks, m.duration, m.bytes)
+	return m
+}
+
+func (m *runnerMetrics) observe(phase, status string, elapsed time.Duration, read, written int64) {
+	m.tasks.WithLabelValues(phase, status).Inc()
+	m.duration.WithLabelValues(phase).Observe(elapsed.Seconds())
+	m.bytes.WithLabelValues(phase, "read").Add(float64(read))
+	m.bytes.WithLabelValues(phase, "written").Add(float64(written))
+}
+
+//serve exposes metrics on addr at /metrics
+func (m *runnerMetrics) serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		log.Error(err)
+	}
+}
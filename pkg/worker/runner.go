@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -10,6 +11,10 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"github.com/turbobytes/kubemr/pkg/job"
+	"github.com/turbobytes/kubemr/pkg/storage"
+	"github.com/turbobytes/kubemr/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //Runner manages the lifecycle of a worker
@@ -19,33 +24,27 @@ type Runner struct {
 	name, ns string
 	hostname string //for locking, debugging
 	utils    *Utilities
+	metrics  *runnerMetrics
+	//How often progress set through Utilities is sent to the master
+	ProgressInterval time.Duration
 }
 
 //NewRunner initializes things from enviornment and returns a NewRunner
 func NewRunner() (*Runner, error) {
 	cfg := job.NewConfigEnv()
 	//Initialize utils
-	auth := aws.Auth{
-		AccessKey: os.Getenv("KUBEMR_S3_ACCESS_KEY_ID"),
-		SecretKey: os.Getenv("KUBEMR_S3_SECRET_ACCESS_KEY"),
-	}
-	region, ok := aws.Regions[cfg.S3Region]
-	if !ok {
-		return nil, fmt.Errorf("Unable to load S3 region")
-	}
-	if cfg.S3Endpoint != "" {
-		region.S3Endpoint = cfg.S3Endpoint
-	}
-	s := s3.New(auth, region)
-
-	jobclient := job.NewClient(cfg.JobURL)
-	var err error
-	r := &Runner{}
-	r.hostname, err = os.Hostname()
+	utils, err := utilitiesEnv(cfg)
 	if err != nil {
 		return nil, err
 	}
-	r.cl = jobclient
+	hostname := os.Getenv("KUBEMR_WORKER_NAME")
+	if hostname == "" {
+		hostname, err = os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+	}
+	r := NewLocalRunner(cfg.JobURL, hostname, utils)
 	r.job, err = r.cl.GetJob()
 	if err != nil {
 		return nil, err
@@ -65,19 +64,70 @@ func NewRunner() (*Runner, error) {
 	case job.StatusComplete:
 		return nil, fmt.Errorf(r.job.Status)
 	}
+	if interval, err := time.ParseDuration(os.Getenv("KUBEMR_PROGRESS_INTERVAL")); err == nil {
+		r.ProgressInterval = interval
+	}
+	//Optionally expose metrics
+	if addr := os.Getenv("KUBEMR_METRICS_ADDR"); addr != "" {
+		go r.metrics.serve(addr)
+	}
+	return r, nil
+}
+
+//NewLocalRunner returns a Runner named name, working on the job at jobURL with utils
+//Unlike NewRunner it does not need the environment of a worker pod, e.g. to run workers in-process
+func NewLocalRunner(jobURL, name string, utils *Utilities) *Runner {
+	return &Runner{
+		cl:               job.NewClient(jobURL),
+		hostname:         name,
+		utils:            utils,
+		metrics:          newRunnerMetrics(),
+		ProgressInterval: 10 * time.Second,
+	}
+}
 
+//utilitiesEnv returns Utilities keeping objects in the S3 bucket from env, or under KUBEMR_STORAGE_DIR when running locally
+func utilitiesEnv(cfg *job.Config) (*Utilities, error) {
+	if dir := os.Getenv("KUBEMR_STORAGE_DIR"); dir != "" {
+		st, err := storage.NewFS(dir)
+		if err != nil {
+			return nil, err
+		}
+		return NewStorageUtilities(st, cfg.BucketName, cfg.BucketPrefix), nil
+	}
+	auth := aws.Auth{
+		AccessKey: os.Getenv("KUBEMR_S3_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("KUBEMR_S3_SECRET_ACCESS_KEY"),
+	}
+	region, ok := aws.Regions[cfg.S3Region]
+	if !ok {
+		return nil, fmt.Errorf("Unable to load S3 region")
+	}
+	if cfg.S3Endpoint != "" {
+		region.S3Endpoint = cfg.S3Endpoint
+	}
+	s := s3.New(auth, region)
 	//Ensure bucket exists
-	bucket := s.Bucket(os.Getenv("KUBEMR_S3_BUCKET_NAME"))
+	bucket := s.Bucket(cfg.BucketName)
 	//TODO: Check before attempting put. Maybe this should be done elsewhere
 	bucket.PutBucket("")
-	r.utils = NewUtilities(bucket, cfg.BucketPrefix)
-	//TODO
-	return r, nil
+	return NewUtilities(bucket, cfg.BucketPrefix), nil
 }
 
 //Run runs a worker
-func (r *Runner) Run(w JobWorker) error {
+func (r *Runner) Run(w JobWorker) (err error) {
+	if r.job == nil {
+		r.job, err = r.cl.GetJob()
+		if err != nil {
+			return err
+		}
+	}
 	for {
+		if r.retired() {
+			//The master has enough workers without us
+			log.Info("Retired by the master")
+			return nil
+		}
 		err := r.work(w)
 		if err != nil {
 			return err
@@ -104,6 +154,16 @@ func (r *Runner) Run(w JobWorker) error {
 	}
 }
 
+//retired tells if the master asked this worker to exit
+func (r *Runner) retired() bool {
+	for _, name := range r.job.Retire {
+		if name == r.hostname {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Runner) work(w JobWorker) error {
 	switch r.job.Status {
 	case job.StatusMap:
@@ -133,69 +193,151 @@ func (r *Runner) work(w JobWorker) error {
 	return nil
 }
 
-func (r *Runner) runReduce(w JobWorker, id int) error {
+//reportProgress calls put with the progress set through Utilities every ProgressInterval until stop is closed
+//The returned channel is closed once reporting has stopped
+func (r *Runner) reportProgress(stop chan bool, put func(*job.Progress) error) chan bool {
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(r.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				progress := r.utils.takeProgress()
+				if progress == nil {
+					continue
+				}
+				err := put(progress)
+				if err != nil {
+					log.Warn(err)
+				}
+			}
+		}
+	}()
+	return done
+}
+
+//startSpan starts the span covering a task, under the span of the job
+func (r *Runner) startSpan(phase string, id int) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(r.cl.JobContext(), phase, trace.WithAttributes(
+		attribute.Int("kubemr.task", id),
+		attribute.String("kubemr.worker", r.hostname),
+	))
+}
+
+func (r *Runner) runReduce(w JobWorker, id int) (err error) {
+	ctx, span := r.startSpan("reduce", id)
+	defer func() { tracing.EndSpan(span, err) }()
 	task := r.job.Reduces[id]
 	//Aquire lock
 	task.Worker = r.hostname
 	task.Status = job.StatusProgress
-	ok, err := r.cl.PutReduce(task, id)
+	ok, err := r.cl.PutReduceContext(ctx, task, id)
 	if err != nil {
 		return err
 	}
+	span.SetAttributes(attribute.Bool("kubemr.acquired", ok))
 	if !ok {
 		//Job was not aquired...
 		return nil
 	}
 
 	//OK lock aquired run reduce
+	r.utils.setAttempt("reduce", id, r.hostname)
+	r.utils.resetBytes()
+	r.utils.resetCounters()
+	r.utils.takeProgress()
+	r.utils.ctx = ctx
+	stop := make(chan bool)
+	reported := r.reportProgress(stop, func(progress *job.Progress) error {
+		update := task
+		update.Progress = progress
+		_, err := r.cl.PutReduceContext(ctx, update, id)
+		return err
+	})
+	start := time.Now()
 	output, err := w.Reduce(id, task.Inputs, r.utils)
+	close(stop)
+	<-reported
+	r.utils.ctx = nil
+	task.BytesRead, task.BytesWritten = r.utils.resetBytes()
+	task.Counters = r.utils.resetCounters()
 	if err != nil {
 		log.Error(err)
+		span.RecordError(err)
+		r.metrics.observe("reduce", job.StatusFail, time.Since(start), task.BytesRead, task.BytesWritten)
 		//Stamp err
 		task.Status = job.StatusFail
 		task.Err = err.Error()
-		_, err = r.cl.PutReduce(task, id)
+		_, err = r.cl.PutReduceContext(ctx, task, id)
 
 		return err
 	}
 	//OK success!
+	r.metrics.observe("reduce", job.StatusComplete, time.Since(start), task.BytesRead, task.BytesWritten)
 	task.Status = job.StatusComplete
 	task.Output = output
-	ok, err = r.cl.PutReduce(task, id)
+	ok, err = r.cl.PutReduceContext(ctx, task, id)
 	if !ok && err == nil {
 		return fmt.Errorf("Something went terribly wrong, check logs for PutMap")
 	}
 	return err
 }
 
-func (r *Runner) runMap(w JobWorker, id int) error {
+func (r *Runner) runMap(w JobWorker, id int) (err error) {
+	ctx, span := r.startSpan("map", id)
+	defer func() { tracing.EndSpan(span, err) }()
 	task := r.job.Maps[id]
 	//Aquire lock
 	task.Worker = r.hostname
 	task.Status = job.StatusProgress
-	ok, err := r.cl.PutMap(task, id)
+	ok, err := r.cl.PutMapContext(ctx, task, id)
 	if err != nil {
 		return err
 	}
+	span.SetAttributes(attribute.Bool("kubemr.acquired", ok))
 	if !ok {
 		//Job was not aquired...
 		return nil
 	}
 	//OK. So now task jas been aquired and locked
+	r.utils.setAttempt("map", id, r.hostname)
+	r.utils.resetBytes()
+	r.utils.resetCounters()
+	r.utils.takeProgress()
+	r.utils.ctx = ctx
+	stop := make(chan bool)
+	reported := r.reportProgress(stop, func(progress *job.Progress) error {
+		update := task
+		update.Progress = progress
+		_, err := r.cl.PutMapContext(ctx, update, id)
+		return err
+	})
+	start := time.Now()
 	outputs, err := w.Map(id, r.job.Maps[id].Input, r.utils)
+	close(stop)
+	<-reported
+	r.utils.ctx = nil
+	task.BytesRead, task.BytesWritten = r.utils.resetBytes()
+	task.Counters = r.utils.resetCounters()
 	if err != nil {
 		log.Error(err)
+		span.RecordError(err)
+		r.metrics.observe("map", job.StatusFail, time.Since(start), task.BytesRead, task.BytesWritten)
 		//Stamp err
 		task.Status = job.StatusFail
 		task.Err = err.Error()
-		_, err = r.cl.PutMap(task, id)
+		_, err = r.cl.PutMapContext(ctx, task, id)
 		return err
 	}
 	//OK success!
-
+	r.metrics.observe("map", job.StatusComplete, time.Since(start), task.BytesRead, task.BytesWritten)
 	task.Status = job.StatusComplete
 	task.Outputs = outputs
-	ok, err = r.cl.PutMap(task, id)
+	ok, err = r.cl.PutMapContext(ctx, task, id)
 	if !ok && err == nil {
 		return fmt.Errorf("Something went terribly wrong, check logs for PutMap")
 	}
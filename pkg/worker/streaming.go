@@ -0,0 +1,281 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/turbobytes/kubemr/pkg/job"
+)
+
+//StreamingWorker is a JobWorker compatible with hadoop streaming
+//
+//Mapper gets the lines of the input on stdin and emits key<tab>value lines on stdout.
+//Those are partitioned by key, uploaded, sorted and grouped before being fed to Reducer on stdin.
+//Whatever Reducer prints on stdout is the output of the reduce task.
+//Like hadoop, stderr lines of the form reporter:counter:<group>,<counter>,<amount> increment counters.
+type StreamingWorker struct {
+	Mapper     []string //Command and args of the mapper
+	Reducer    []string //Command and args of the reducer
+	Partitions int      //Number of reduce tasks, defaults to 1
+	Separator  string   //Single character separating key from value, defaults to tab
+}
+
+func (w *StreamingWorker) separator() string {
+	if w.Separator == "" {
+		return "\t"
+	}
+	return w.Separator
+}
+
+//partition uses FNV-1a non-cryptographic hash to determine the partition for a key
+func partition(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+//Map pipes input through Mapper and partitions its output by key
+func (w *StreamingWorker) Map(id int, input string, utils *Utilities) (map[int]string, error) {
+	if len(w.Mapper) == 0 {
+		return nil, fmt.Errorf("No mapper configured")
+	}
+	n := w.Partitions
+	if n < 1 {
+		n = 1
+	}
+	sep := w.separator()
+	rd, err := openStreamingInput(utils, input)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	//One TempFile for each partition
+	tmpfiles := make([]*os.File, n)
+	for i := range tmpfiles {
+		tmpfiles[i], err = ioutil.TempFile("", "")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmpfiles[i].Name())
+		defer tmpfiles[i].Close()
+	}
+	written := make([]bool, n)
+	cmd := exec.Command(w.Mapper[0], w.Mapper[1:]...)
+	cmd.Stdin = rd
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	reported := reportCounters(stderr, utils)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		key := strings.SplitN(line, sep, 2)[0]
+		p := partition(key, n)
+		fmt.Fprintln(tmpfiles[p], line)
+		written[p] = true
+	}
+	scanerr := scanner.Err()
+	if scanerr != nil {
+		//Drain so the mapper does not block forever
+		io.Copy(ioutil.Discard, stdout)
+	}
+	<-reported
+	err = cmd.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("mapper: %s", err)
+	}
+	if scanerr != nil {
+		return nil, scanerr
+	}
+	//Upload non-empty partitions
+	outputs := make(map[int]string)
+	for i, f := range tmpfiles {
+		f.Close()
+		if !written[i] {
+			continue
+		}
+		outputs[i], err = utils.UploadFilename(fmt.Sprintf("map/%v-%v.txt", id, i), f.Name())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
+
+//Reduce merges and sorts inputs, and feeds them grouped by key to Reducer
+func (w *StreamingWorker) Reduce(id int, inputs []string, utils *Utilities) (string, error) {
+	if len(w.Reducer) == 0 {
+		return "", fmt.Errorf("No reducer configured")
+	}
+	sep := w.separator()
+	//Download and merge each input into local file
+	merged, err := ioutil.TempFile("", "")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(merged.Name())
+	for _, input := range inputs {
+		rd, err := utils.GetS3Object(input)
+		if err != nil {
+			merged.Close()
+			return "", err
+		}
+		_, err = io.Copy(merged, rd)
+		rd.Close()
+		if err != nil {
+			merged.Close()
+			return "", err
+		}
+	}
+	merged.Close()
+	//Sort on the key only, byte order
+	sorted, err := ioutil.TempFile("", "")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(sorted.Name())
+	sortcmd := exec.Command("sort", "-t", sep, "-k1,1", merged.Name())
+	sortcmd.Env = append(os.Environ(), "LC_ALL=C")
+	sortcmd.Stdout = sorted
+	sortcmd.Stderr = os.Stderr
+	err = sortcmd.Run()
+	sorted.Close()
+	if err != nil {
+		return "", fmt.Errorf("sort: %s", err)
+	}
+	f, err := os.Open(sorted.Name())
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	output, err := ioutil.TempFile("", "")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+	cmd := exec.Command(w.Reducer[0], w.Reducer[1:]...)
+	records := &lineCounter{w: output}
+	cmd.Stdout = records
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return "", err
+	}
+	reported := reportCounters(stderr, utils)
+	//Feed groups to the reducer
+	g := make(chan *Group)
+	go KVGroup(f, g, sep)
+	wr := bufio.NewWriter(stdin)
+	var writeerr error
+	for group := range g {
+		for v := range group.Vals {
+			if writeerr == nil {
+				if v == nil {
+					//Line had no value, pass it on unchanged
+					_, writeerr = fmt.Fprintf(wr, "%s\n", group.Key)
+				} else {
+					_, writeerr = fmt.Fprintf(wr, "%s%s%s\n", group.Key, sep, v)
+				}
+			}
+		}
+	}
+	if writeerr == nil {
+		writeerr = wr.Flush()
+	}
+	stdin.Close()
+	<-reported
+	err = cmd.Wait()
+	if err != nil {
+		return "", fmt.Errorf("reducer: %s", err)
+	}
+	if writeerr != nil {
+		return "", writeerr
+	}
+	output.Close()
+	utils.IncrCounter(job.CounterOutputRecords, records.lines)
+	return utils.UploadFilename(fmt.Sprintf("reduce/%v.txt", id), output.Name())
+}
+
+//lineCounter counts the lines written through it
+type lineCounter struct {
+	w     io.Writer
+	lines int64
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	c.lines += int64(bytes.Count(p, []byte("\n")))
+	return c.w.Write(p)
+}
+
+//reportCounters increments counters for hadoop style reporter lines on stderr, and passes on everything else
+//The returned channel is closed once stderr is drained
+func reportCounters(stderr io.Reader, utils *Utilities) chan bool {
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "reporter:counter:") {
+				parts := strings.Split(strings.TrimPrefix(line, "reporter:counter:"), ",")
+				if len(parts) == 3 {
+					delta, err := strconv.ParseInt(parts[2], 10, 64)
+					if err == nil {
+						utils.IncrCounter(parts[0]+"."+parts[1], delta)
+						continue
+					}
+				}
+			}
+			fmt.Fprintln(os.Stderr, line)
+		}
+		//Keep draining if the scanner gave up, so the command does not block
+		io.Copy(os.Stderr, stderr)
+	}()
+	return done
+}
+
+//openStreamingInput opens kubemr managed objects, http(s) urls and local files
+func openStreamingInput(utils *Utilities, input string) (io.ReadCloser, error) {
+	switch {
+	case strings.HasPrefix(input, "s3://"):
+		return utils.GetS3Object(input)
+	case strings.HasPrefix(input, "http://"), strings.HasPrefix(input, "https://"):
+		resp, err := http.Get(input)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s returned %s", input, resp.Status)
+		}
+		return resp.Body, nil
+	}
+	return os.Open(strings.TrimPrefix(input, "file://"))
+}
@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/turbobytes/kubemr/pkg/job"
+)
+
+func TestStreamingWorker(t *testing.T) {
+	utils, quit := testUtilities(t)
+	defer quit()
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("foo bar\nbaz foo\nfoo\n")
+	f.Close()
+	w := &StreamingWorker{
+		//Classic streaming wordcount
+		Mapper:     []string{"awk", `{for (i = 1; i <= NF; i++) {print $i "\t1"; print "reporter:counter:wc,words,1" > "/dev/stderr"}}`},
+		Reducer:    []string{"awk", "-F", "\t", `{c[$1] += $2} END {for (k in c) print k "\t" c[k]}`},
+		Partitions: 3,
+	}
+	outputs, err := w.Map(0, f.Name(), utils)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) == 0 || len(outputs) > 3 {
+		t.Fatalf("Expected between 1 and 3 partitions, got %v", len(outputs))
+	}
+	if c := utils.resetCounters()["wc.words"]; c != 5 {
+		t.Errorf("Expected counter wc.words to be 5, got %v", c)
+	}
+	lines := make([]string, 0)
+	for id, output := range outputs {
+		//Same input twice doubles the counts
+		result, err := w.Reduce(id, []string{output, output}, utils)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item, err := utils.GetS3Object(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := ioutil.ReadAll(item)
+		item.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.Split(strings.TrimSpace(string(d)), "\n")...)
+	}
+	//3 distinct words over all partitions
+	if c := utils.resetCounters()[job.CounterOutputRecords]; c != 3 {
+		t.Errorf("Expected 3 output records, got %v", c)
+	}
+	sort.Strings(lines)
+	got := strings.Join(lines, ",")
+	if got != "bar\t2,baz\t2,foo\t6" {
+		t.Errorf("Unexpected results %q", got)
+	}
+}
+
+func TestStreamingWorkerNoValue(t *testing.T) {
+	utils, quit := testUtilities(t)
+	defer quit()
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("solo\nkey\tval\nempty\t\n")
+	f.Close()
+	//Identity mapper and reducer must not change lines
+	w := &StreamingWorker{Mapper: []string{"cat"}, Reducer: []string{"cat"}}
+	outputs, err := w.Map(0, f.Name(), utils)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := w.Reduce(0, []string{outputs[0]}, utils)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := utils.GetS3Object(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ioutil.ReadAll(item)
+	item.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != "empty\t\nkey\tval\nsolo\n" {
+		t.Errorf("Unexpected results %q", d)
+	}
+}
+
+//Test lines with an empty key are grouped like any other key
+func TestStreamingWorkerEmptyKey(t *testing.T) {
+	utils, quit := testUtilities(t)
+	defer quit()
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("\t1\nfoo\t1\n\t2\n")
+	f.Close()
+	w := &StreamingWorker{Mapper: []string{"cat"}, Reducer: []string{"cat"}}
+	outputs, err := w.Map(0, f.Name(), utils)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := w.Reduce(0, []string{outputs[0]}, utils)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := utils.GetS3Object(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ioutil.ReadAll(item)
+	item.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != "\t1\n\t2\nfoo\t1\n" {
+		t.Errorf("Unexpected results %q", d)
+	}
+}
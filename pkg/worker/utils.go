@@ -1,29 +1,66 @@
 package worker
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/turbobytes/kubemr/pkg/job"
+	"github.com/turbobytes/kubemr/pkg/storage"
+	"github.com/turbobytes/kubemr/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/amz.v1/s3"
 )
 
 //Utilities provide common useful methods that map/reduce functions may make use off.
 type Utilities struct {
-	bucket *s3.Bucket
-	prefix string
+	read     int64 //Bytes downloaded since last reset, accessed atomically. Kept first for 64-bit alignment
+	written  int64 //Bytes uploaded since last reset, accessed atomically
+	store    storage.Storage
+	bucket   string          //Name of the bucket, for URIs
+	base     string          //Prefix of the run
+	prefix   string          //Prefix of the running task attempt
+	ctx      context.Context //Trace of the running task, nil outside tasks
+	mu       sync.Mutex
+	counters map[string]int64
+	progress *job.Progress //Latest progress, nil once shipped
 }
 
 //NewUtilities creates new helper object
 func NewUtilities(bucket *s3.Bucket, prefix string) *Utilities {
-	return &Utilities{bucket: bucket, prefix: prefix}
+	return NewStorageUtilities(&storage.S3{Bucket: bucket}, bucket.Name, prefix)
+}
+
+//NewStorageUtilities creates new helper object keeping objects in st, which are named s3://bucket/key
+func NewStorageUtilities(st storage.Storage, bucket, prefix string) *Utilities {
+	return &Utilities{store: st, bucket: bucket, base: prefix, prefix: prefix}
+}
+
+//setAttempt makes uploads go to the attempt of a task
+func (utils *Utilities) setAttempt(phase string, taskid int, worker string) {
+	utils.prefix = utils.base + job.AttemptPrefix(phase, taskid, worker)
+}
+
+//context returns the context of the running task
+func (utils *Utilities) context() context.Context {
+	if utils.ctx == nil {
+		return context.Background()
+	}
+	return utils.ctx
 }
 
 //UploadFilename uploads file src into key in bucket
-func (utils *Utilities) UploadFilename(key, src string) (string, error) {
+func (utils *Utilities) UploadFilename(key, src string) (dst string, err error) {
+	_, span := tracing.Tracer().Start(utils.context(), "UploadFilename")
+	defer func() { tracing.EndSpan(span, err) }()
 	key = utils.prefix + key
-	dst := "s3://" + utils.bucket.Name + key
+	span.SetAttributes(attribute.String("kubemr.key", key))
+	dst = "s3://" + utils.bucket + key
 	f, err := os.Open(src)
 	if err != nil {
 		return "", err
@@ -33,18 +70,105 @@ func (utils *Utilities) UploadFilename(key, src string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	err = utils.bucket.PutReader(key, f, stat.Size(), "application/octet-stream", "")
+	err = utils.store.PutReader(key, f, stat.Size())
 	if err != nil {
 		return "", err
 	}
+	atomic.AddInt64(&utils.written, stat.Size())
 	return dst, nil
 }
 
 //GetS3Object gets object from s3, errors if src is not fully qualified uri matching our bucket
-func (utils *Utilities) GetS3Object(src string) (io.ReadCloser, error) {
-	if !strings.HasPrefix(src, "s3://"+utils.bucket.Name) {
+//The trace span of the download ends when the returned reader is closed
+func (utils *Utilities) GetS3Object(src string) (rc io.ReadCloser, err error) {
+	_, span := tracing.Tracer().Start(utils.context(), "GetS3Object")
+	span.SetAttributes(attribute.String("kubemr.src", src))
+	defer func() {
+		if err != nil {
+			tracing.EndSpan(span, err)
+		}
+	}()
+	if !strings.HasPrefix(src, "s3://"+utils.bucket+"/") {
 		return nil, fmt.Errorf("src is not kubemr managed s3 resource belonging to this job")
 	}
-	key := strings.Replace(src, "s3://"+utils.bucket.Name, "", 1)
-	return utils.bucket.GetReader(key)
+	key := strings.TrimPrefix(src, "s3://"+utils.bucket)
+	rd, err := utils.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReader{ReadCloser: rd, n: &utils.read, span: span}, nil
+}
+
+//IncrCounter adds delta to the named counter of the running task
+//Counters are reported to the master when the task finishes, and summed per phase and job
+func (utils *Utilities) IncrCounter(name string, delta int64) {
+	utils.mu.Lock()
+	defer utils.mu.Unlock()
+	if utils.counters == nil {
+		utils.counters = make(map[string]int64)
+	}
+	utils.counters[name] += delta
+}
+
+//resetCounters returns the counters incremented since the previous call
+func (utils *Utilities) resetCounters() map[string]int64 {
+	utils.mu.Lock()
+	defer utils.mu.Unlock()
+	counters := utils.counters
+	utils.counters = nil
+	return counters
+}
+
+//SetProgress records how far along the running task is. The worker ships it to the master periodically
+func (utils *Utilities) SetProgress(fraction float64, bytes int64, message string) {
+	utils.mu.Lock()
+	defer utils.mu.Unlock()
+	utils.progress = &job.Progress{Fraction: fraction, Bytes: bytes, Message: message}
+}
+
+//takeProgress returns the progress set since the previous call, nil if there is none
+func (utils *Utilities) takeProgress() *job.Progress {
+	utils.mu.Lock()
+	defer utils.mu.Unlock()
+	progress := utils.progress
+	utils.progress = nil
+	return progress
+}
+
+//resetBytes returns bytes read and written since the previous call
+func (utils *Utilities) resetBytes() (read, written int64) {
+	return atomic.SwapInt64(&utils.read, 0), atomic.SwapInt64(&utils.written, 0)
+}
+
+//countingReader adds the number of bytes read to n, and ends span if any once closed
+type countingReader struct {
+	io.ReadCloser
+	n    *int64
+	read int64
+	err  error //First error reading other than io.EOF
+	span trace.Span
+}
+
+func (rd *countingReader) Read(p []byte) (int, error) {
+	n, err := rd.ReadCloser.Read(p)
+	atomic.AddInt64(rd.n, int64(n))
+	rd.read += int64(n)
+	if err != nil && err != io.EOF && rd.err == nil {
+		rd.err = err
+	}
+	return n, err
+}
+
+func (rd *countingReader) Close() error {
+	err := rd.ReadCloser.Close()
+	if rd.span != nil {
+		rd.span.SetAttributes(attribute.Int64("kubemr.bytes", rd.read))
+		spanerr := rd.err
+		if spanerr == nil {
+			spanerr = err
+		}
+		tracing.EndSpan(rd.span, spanerr)
+		rd.span = nil
+	}
+	return err
 }
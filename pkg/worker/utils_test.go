@@ -5,11 +5,34 @@ import (
 	"os"
 	"testing"
 
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"gopkg.in/amz.v1/aws"
 	"gopkg.in/amz.v1/s3"
 	"gopkg.in/amz.v1/s3/s3test"
 )
 
+//testUtilities returns Utilities backed by a local s3test server, call quit when done
+func testUtilities(t *testing.T) (*Utilities, func()) {
+	srv, err := s3test.NewServer(&s3test.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	region := aws.Region{
+		Name:                 "test",
+		S3Endpoint:           srv.URL(),
+		S3LocationConstraint: true, // s3test server requires a LocationConstraint
+		Sign:                 aws.SignV2,
+	}
+	bucket := s3.New(aws.Auth{}, region).Bucket("foo")
+	err = bucket.PutBucket(s3.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewUtilities(bucket, "/foo/"), srv.Quit
+}
+
 func TestUtilities(t *testing.T) {
 	srv, err := s3test.NewServer(&s3test.Config{})
 	if err != nil {
@@ -65,3 +88,49 @@ func TestUtilities(t *testing.T) {
 		t.Error("Expected an error, got nil")
 	}
 }
+
+//Test the span of a download covers reading it
+func TestGetS3ObjectSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	utils, quit := testUtilities(t)
+	defer quit()
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("foobar")
+	f.Close()
+	loc, err := utils.UploadFilename("key", f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := utils.GetS3Object(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended := func(name string) sdktrace.ReadOnlySpan {
+		for _, span := range recorder.Ended() {
+			if span.Name() == name {
+				return span
+			}
+		}
+		return nil
+	}
+	if ended("GetS3Object") != nil {
+		t.Error("Expected the span to last until the object is closed")
+	}
+	ioutil.ReadAll(item)
+	item.Close()
+	span := ended("GetS3Object")
+	if span == nil {
+		t.Fatal("Expected the span to end once the object is closed")
+	}
+	for _, attr := range span.Attributes() {
+		if attr.Key == "kubemr.bytes" && attr.Value.AsInt64() != 6 {
+			t.Errorf("Expected 6 bytes read, got %v", attr.Value.AsInt64())
+		}
+	}
+}